@@ -0,0 +1,125 @@
+// ASCII text I/O for ship computer programs.
+//
+// Many programs read commands as character codes ending in a newline and print their
+// responses the same way. Output values above 127 can't be characters; they are the
+// program's numeric results and are kept separately.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const maxASCII = 127
+
+var ErrNotASCII = errors.New("text is not ASCII")
+
+// Queue text as character codes. Text with any character above 127 is refused, and nothing is queued.
+func addASCIIInput(computer *IntComputer, text string) error {
+	for i, r := range text {
+		if r > maxASCII {
+			return fmt.Errorf("%w: %q at byte %d", ErrNotASCII, r, i)
+		}
+	}
+	for _, b := range []byte(text) {
+		addInput(computer, int(b))
+	}
+	return nil
+}
+
+// Queue a command, adding the newline that ends it if it's missing
+func addASCIICommand(computer *IntComputer, command string) error {
+	if !strings.HasSuffix(command, "\n") {
+		command += "\n"
+	}
+	return addASCIIInput(computer, command)
+}
+
+// Groups output character codes into lines. Values that aren't ASCII go to values.
+// If onLine is set, each line is passed to it as soon as it is complete instead of being kept.
+// If onValue is set too, values are passed to it as they come, after handing any text
+// written since the last newline to onLine, so the two stay in order.
+type ASCIIOutput struct {
+	lines   []string
+	values  []int
+	partial strings.Builder
+	onLine  func(line string)
+	onValue func(value int)
+	split   bool // the current line was handed over early; its newline ends nothing more
+}
+
+func (out *ASCIIOutput) Write(value int) {
+	switch {
+	case value < 0 || value > maxASCII:
+		if out.onLine == nil || out.onValue == nil {
+			out.values = append(out.values, value)
+			return
+		}
+		if out.partial.Len() > 0 {
+			out.endLine()
+			out.split = true
+		}
+		out.onValue(value)
+	case value == '\n':
+		if out.split && out.partial.Len() == 0 {
+			out.split = false
+			return
+		}
+		out.endLine()
+	default:
+		out.split = false
+		out.partial.WriteByte(byte(value))
+	}
+}
+
+func (out *ASCIIOutput) endLine() {
+	line := out.partial.String()
+	out.partial.Reset()
+	if out.onLine != nil {
+		out.onLine(line)
+	} else {
+		out.lines = append(out.lines, line)
+	}
+}
+
+// Text written since the last newline
+func (out *ASCIIOutput) pending() string {
+	return out.partial.String()
+}
+
+// Drain the computer's collected outputs, splitting them into text and non-ASCII values.
+// A final line without a newline is returned as the last line.
+func readASCIIOutput(computer *IntComputer) (lines []string, values []int) {
+	var out ASCIIOutput
+	for _, value := range computer.outputs {
+		out.Write(value)
+	}
+	computer.outputs = nil
+
+	lines = out.lines
+	if rest := out.pending(); rest != "" {
+		lines = append(lines, rest)
+	}
+	return lines, out.values
+}
+
+// Feeds the bytes of a reader as character codes, e.g. a terminal's standard input
+type ASCIIReaderInput struct {
+	r *bufio.Reader
+}
+
+func newASCIIReaderInput(r io.Reader) *ASCIIReaderInput {
+	return &ASCIIReaderInput{bufio.NewReader(r)}
+}
+
+func (in *ASCIIReaderInput) Read() (int, bool) {
+	b, err := in.r.ReadByte()
+	if err != nil {
+		return 0, false
+	}
+	return int(b), true
+}
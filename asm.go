@@ -0,0 +1,229 @@
+// Assembler for ship computer programs.
+//
+// Source is one instruction per line, using the mnemonics and operand notation of the disassembler:
+//
+//	loop:   IN   [x]          ; a label, then position mode
+//	        EQ   [x], #8, rb+2 ; immediate and relative modes
+//	        JT   [x], #loop   ; labels can be used wherever a number can, with an optional +/- offset
+//	        HALT
+//	x:      DATA -1, 0, 0     ; raw words
+//
+// Comments start with ';'. Mnemonics are case-insensitive.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// An assembly error, pointing at the offending source line (numbered from 1)
+type AsmError struct {
+	Line   int
+	Source string
+	Msg    string
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Msg, strings.TrimSpace(e.Source))
+}
+
+// A source line split into its parts
+type asmStatement struct {
+	line     int
+	source   string
+	mnemonic string
+	operands []string
+	addr     int
+}
+
+// Assemble source into a program string that initComputer can load
+func assemble(source string) (string, error) {
+	words, err := assembleWords(source)
+	if err != nil {
+		return "", err
+	}
+	return programString(words), nil
+}
+
+// Assemble source into program words
+func assembleWords(source string) ([]int, error) {
+	opcodes := mnemonicOpcodes(nil)
+	labels := make(map[string]int)
+	var statements []asmStatement
+
+	// First pass: split lines, assign addresses and collect labels
+	addr := 0
+	for id, text := range strings.Split(source, "\n") {
+		stmt := asmStatement{line: id + 1, source: text}
+		if i := strings.Index(text, ";"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		for {
+			i := strings.Index(text, ":")
+			if i < 0 {
+				break
+			}
+			label := strings.TrimSpace(text[:i])
+			if !isLabel(label) {
+				return nil, &AsmError{stmt.line, stmt.source, "bad label " + strconv.Quote(label)}
+			}
+			if _, dup := labels[label]; dup {
+				return nil, &AsmError{stmt.line, stmt.source, "label " + label + " defined twice"}
+			}
+			labels[label] = addr
+			text = strings.TrimSpace(text[i+1:])
+		}
+		if text == "" {
+			continue
+		}
+
+		mnemonic, operands := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			mnemonic, operands = text[:i], strings.TrimSpace(text[i+1:])
+		}
+		stmt.mnemonic = strings.ToUpper(mnemonic)
+		if operands != "" {
+			for _, operand := range strings.Split(operands, ",") {
+				stmt.operands = append(stmt.operands, strings.TrimSpace(operand))
+			}
+		}
+		stmt.addr = addr
+
+		if stmt.mnemonic == "DATA" {
+			if len(stmt.operands) == 0 {
+				return nil, &AsmError{stmt.line, stmt.source, "DATA needs at least one value"}
+			}
+			addr += len(stmt.operands)
+		} else {
+			opcode, ok := opcodes[stmt.mnemonic]
+			if !ok {
+				return nil, &AsmError{stmt.line, stmt.source, "unknown mnemonic " + stmt.mnemonic}
+			}
+			info := instructionSet[opcode]
+			if len(stmt.operands) != info.params {
+				return nil, &AsmError{stmt.line, stmt.source, fmt.Sprintf("%s takes %d operands, got %d", info.name, info.params, len(stmt.operands))}
+			}
+			addr += info.params + 1
+		}
+		statements = append(statements, stmt)
+	}
+
+	// Second pass: encode, now that every label has an address
+	var words []int
+	for _, stmt := range statements {
+		if stmt.mnemonic == "DATA" {
+			for _, operand := range stmt.operands {
+				value, err := resolveValue(operand, labels)
+				if err != nil {
+					return nil, &AsmError{stmt.line, stmt.source, err.Error()}
+				}
+				words = append(words, value)
+			}
+			continue
+		}
+
+		opcode := opcodes[stmt.mnemonic]
+		info := instructionSet[opcode]
+		op := opcode
+		params := make([]int, len(stmt.operands))
+		for p, operand := range stmt.operands {
+			mode, value, err := parseOperand(operand, labels)
+			if err != nil {
+				return nil, &AsmError{stmt.line, stmt.source, err.Error()}
+			}
+			if mode == DIRECT && p+1 == info.write {
+				return nil, &AsmError{stmt.line, stmt.source, fmt.Sprintf("%s can't write to immediate operand %s", info.name, operand)}
+			}
+			op += int(mode) * pow10(p+2)
+			params[p] = value
+		}
+		words = append(words, op)
+		words = append(words, params...)
+	}
+	return words, nil
+}
+
+// Parse an operand: [addr], #value or rb+offset
+func parseOperand(operand string, labels map[string]int) (ParamMode, int, error) {
+	switch {
+	case strings.HasPrefix(operand, "[") && strings.HasSuffix(operand, "]"):
+		value, err := resolveValue(operand[1:len(operand)-1], labels)
+		return POS, value, err
+	case strings.HasPrefix(operand, "#"):
+		value, err := resolveValue(operand[1:], labels)
+		return DIRECT, value, err
+	case strings.HasPrefix(strings.ToLower(operand), "rb"):
+		rest := strings.TrimSpace(operand[2:])
+		if rest == "" {
+			return RELATIVE, 0, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			return RELATIVE, 0, fmt.Errorf("bad relative operand %s", operand)
+		}
+		value, err := resolveValue(strings.TrimSpace(rest[1:]), labels)
+		if rest[0] == '-' {
+			value = -value
+		}
+		return RELATIVE, value, err
+	}
+	return POS, 0, fmt.Errorf("bad operand %s; expected [addr], #value or rb+offset", operand)
+}
+
+// Resolve a number, a label, or a label with a +/- offset
+func resolveValue(expr string, labels map[string]int) (int, error) {
+	expr = strings.TrimSpace(expr)
+	if value, err := strconv.Atoi(expr); err == nil {
+		return value, nil
+	}
+
+	name, offset := expr, 0
+	if i := strings.LastIndexAny(expr, "+-"); i > 0 {
+		n, err := strconv.Atoi(strings.TrimSpace(expr[i+1:]))
+		if err != nil {
+			return 0, fmt.Errorf("bad offset in %s", expr)
+		}
+		if expr[i] == '-' {
+			n = -n
+		}
+		name, offset = strings.TrimSpace(expr[:i]), n
+	}
+	addr, ok := labels[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined label %s", name)
+	}
+	return addr + offset, nil
+}
+
+func isLabel(name string) bool {
+	if name == "" || strings.EqualFold(name, "rb") {
+		return false
+	}
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Program words as the comma-separated string initComputer loads
+func programString(words []int) string {
+	strCode := make([]string, len(words))
+	for id, word := range words {
+		strCode[id] = strconv.Itoa(word)
+	}
+	return strings.Join(strCode, ",")
+}
+
+// Render disassembled lines as assembler source, so a listing can be edited and reassembled
+func listingSource(lines []DisasmLine) string {
+	var b strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&b, "\t%s %s\n", line.mnemonic, strings.Join(line.operands, ", "))
+	}
+	return b.String()
+}
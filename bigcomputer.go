@@ -0,0 +1,271 @@
+// Arbitrary-precision ship computer, for finding out what native int arithmetic gets wrong.
+//
+// A BigComputer runs the built-in instruction set with every memory cell, input and output
+// held as a big.Int, so additions and multiplications are exact. Addresses, jump targets and
+// the relative base must still fit in an int. There is no tracing, predecoding or custom
+// opcodes: it is slow, and meant for comparing against an IntComputer with compareArithmetic.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type BigComputer struct {
+	state           []*big.Int // cells never written are nil and read as 0
+	highWater       int        // highest address loaded or written
+	inputs, outputs []*big.Int
+	ip              int
+	relativeBase    int
+	terminated      bool
+	steps           int
+}
+
+var bigZero = new(big.Int)
+
+// Parse a program, which may hold values too large for an int
+func initBigComputer(state string, ins []int) (*BigComputer, error) {
+	computer := &BigComputer{}
+	for _, input := range ins {
+		computer.inputs = append(computer.inputs, big.NewInt(int64(input)))
+	}
+
+	inst := strings.Split(strings.TrimSpace(state), ",")
+	if len(inst) > computer_ram {
+		return computer, &ComputerError{Err: ErrParse, Detail: fmt.Sprintf("program has %d values, memory holds %d", len(inst), computer_ram)}
+	}
+	computer.state = make([]*big.Int, len(inst))
+	computer.highWater = len(inst) - 1
+	for id, item := range inst {
+		value, ok := new(big.Int).SetString(strings.TrimSpace(item), 10)
+		if !ok {
+			return computer, &ComputerError{Err: ErrParse, IP: id, Detail: fmt.Sprintf("%q is not an integer", item)}
+		}
+		computer.state[id] = value
+	}
+	return computer, nil
+}
+
+// Like computerError, for a BigComputer. Opcode is left 0 if it doesn't fit in an int.
+func bigError(kind error, computer *BigComputer, detail string) error {
+	e := &ComputerError{Err: kind, IP: computer.ip, RelativeBase: computer.relativeBase, Detail: detail}
+	if op := bigPeek(computer, computer.ip); op.IsInt64() {
+		e.Opcode = int(op.Int64())
+	}
+	return e
+}
+
+// Read memory; the result must not be modified
+func bigPeek(computer *BigComputer, addr int) *big.Int {
+	if addr < 0 || addr >= len(computer.state) || computer.state[addr] == nil {
+		return bigZero
+	}
+	return computer.state[addr]
+}
+
+// Like store, for a BigComputer
+func bigStore(computer *BigComputer, addr int, value *big.Int) {
+	if addr >= len(computer.state) {
+		grown := make([]*big.Int, grownSize(len(computer.state), addr))
+		copy(grown, computer.state)
+		computer.state = grown
+	}
+	computer.state[addr] = value
+	if addr > computer.highWater {
+		computer.highWater = addr
+	}
+}
+
+// Convert a value used as a jump target or relative base adjustment, failing unless it fits in an int
+func bigInt(computer *BigComputer, value *big.Int) (int, error) {
+	if !value.IsInt64() {
+		return 0, bigError(ErrAddressOutOfRange, computer, fmt.Sprintf("%v doesn't fit in an int", value))
+	}
+	return int(value.Int64()), nil
+}
+
+// Like getParamValue, without tracing
+func bigParamValue(computer *BigComputer, mode ParamMode, loc int) (*big.Int, error) {
+	param := bigPeek(computer, loc)
+	switch mode {
+	case DIRECT:
+		return param, nil
+	case POS, RELATIVE:
+		addr, err := bigParamAddr(computer, mode, loc)
+		if err != nil {
+			return nil, err
+		}
+		return bigPeek(computer, addr), nil
+	}
+	return nil, bigError(ErrBadParamMode, computer, fmt.Sprintf("mode %d for parameter at %d", mode, loc))
+}
+
+// Like getParamAddr, for a parameter that must fit in an int
+func bigParamAddr(computer *BigComputer, mode ParamMode, loc int) (int, error) {
+	param, err := bigInt(computer, bigPeek(computer, loc))
+	if err != nil {
+		return 0, err
+	}
+	return paramAddr(mode, loc, param, computer.relativeBase, func(kind error, detail string) error {
+		return bigError(kind, computer, detail)
+	})
+}
+
+// Execute the next instruction. A computer that has halted or is waiting for input is left unchanged.
+func stepBig(computer *BigComputer) error {
+	if computer.ip < 0 || computer.ip >= computer_ram {
+		return bigError(ErrAddressOutOfRange, computer, fmt.Sprintf("instruction pointer %d", computer.ip))
+	}
+	op := bigPeek(computer, computer.ip)
+	if !op.IsInt64() {
+		return bigError(ErrUnknownOpcode, computer, "")
+	}
+	opcode, modes := decodeOp(int(op.Int64()))
+	info, ok := instructionSet[opcode]
+	switch {
+	case !ok:
+		return bigError(ErrUnknownOpcode, computer, "")
+	case opcode == 99:
+		computer.terminated = true
+		return nil
+	case opcode == 3 && len(computer.inputs) == 0:
+		return nil
+	}
+
+	// Values of the read parameters, and the address of the written one
+	values := make([]*big.Int, info.params+1)
+	var dest int
+	for p := 1; p <= info.params; p++ {
+		var err error
+		if p == info.write {
+			dest, err = bigParamAddr(computer, modes[p], computer.ip+p)
+		} else {
+			values[p], err = bigParamValue(computer, modes[p], computer.ip+p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	next := computer.ip + info.params + 1
+	switch opcode {
+	case 1:
+		bigStore(computer, dest, new(big.Int).Add(values[1], values[2]))
+	case 2:
+		bigStore(computer, dest, new(big.Int).Mul(values[1], values[2]))
+	case 3:
+		bigStore(computer, dest, computer.inputs[0])
+		computer.inputs = computer.inputs[1:]
+	case 4:
+		computer.outputs = append(computer.outputs, values[1])
+	case 5, 6:
+		if (values[1].Sign() != 0) == (opcode == 5) {
+			target, err := bigInt(computer, values[2])
+			if err != nil {
+				return err
+			}
+			next = target
+		}
+	case 7, 8:
+		cmp := values[1].Cmp(values[2])
+		result := bigZero
+		if (opcode == 7 && cmp < 0) || (opcode == 8 && cmp == 0) {
+			result = big.NewInt(1)
+		}
+		bigStore(computer, dest, result)
+	case 9:
+		offset, err := bigInt(computer, values[1])
+		if err != nil {
+			return err
+		}
+		computer.relativeBase += offset
+	}
+	computer.ip = next
+	computer.steps++
+	return nil
+}
+
+// Run until the program halts or needs input
+func runBig(computer *BigComputer) error {
+	for !computer.terminated {
+		steps := computer.steps
+		if err := stepBig(computer); err != nil {
+			return err
+		}
+		if computer.steps == steps {
+			return nil // waiting for input
+		}
+	}
+	return nil
+}
+
+// Where a native run of a program first disagrees with an exact one
+type Divergence struct {
+	Step   int // counts from 1
+	IP     int
+	Addr   int // memory cell written, or -1 for an output
+	Native int
+	Exact  *big.Int
+}
+
+func (d *Divergence) String() string {
+	where := fmt.Sprintf("writing [%d]", d.Addr)
+	if d.Addr < 0 {
+		where = "writing output"
+	}
+	return fmt.Sprintf("step %d at ip=%d, %s: native %d, exact %v", d.Step, d.IP, where, d.Native, d.Exact)
+}
+
+// Keeps the record of the latest instruction
+type lastRecord struct {
+	record TraceRecord
+}
+
+func (t *lastRecord) Trace(record TraceRecord) {
+	t.record = record
+}
+
+// Run program natively and with big.Int arithmetic in lockstep, with the same inputs, and
+// report the first value the native run gets wrong. It returns nil if they agree until the
+// program halts or runs out of input.
+func compareArithmetic(program string, inputs []int) (*Divergence, error) {
+	native, err := initComputer(program, inputs)
+	if err != nil {
+		return nil, err
+	}
+	exact, err := initBigComputer(program, inputs)
+	if err != nil {
+		return nil, err
+	}
+	last := &lastRecord{}
+	attachTracer(native, last)
+
+	for !native.terminated {
+		steps := native.steps
+		if err := runStep(native); err != nil {
+			return nil, err
+		}
+		if native.steps == steps {
+			return nil, nil // halted or waiting for input
+		}
+		if err := stepBig(exact); err != nil {
+			return nil, err
+		}
+
+		record := last.record
+		for _, write := range record.Writes {
+			if value := bigPeek(exact, write.Addr); !value.IsInt64() || value.Int64() != int64(write.New) {
+				return &Divergence{record.Step, record.IP, write.Addr, write.New, value}, nil
+			}
+		}
+		if record.Output != nil {
+			value := exact.outputs[len(exact.outputs)-1]
+			if !value.IsInt64() || value.Int64() != int64(*record.Output) {
+				return &Divergence{record.Step, record.IP, -1, *record.Output, value}, nil
+			}
+		}
+	}
+	return nil, nil
+}
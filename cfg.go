@@ -0,0 +1,275 @@
+// Control-flow graphs for ship computer programs, with Graphviz export.
+//
+// The program is decoded by following control flow from its entry points, then split into
+// basic blocks at jump targets and after jumps. A jump target is resolved when it is
+// immediate, or a position-mode cell that no reachable instruction writes in position mode.
+// (Relative-mode writes are assumed not to hit code or jump tables.) Jumps whose targets
+// can't be resolved, like the computed returns of programs with subroutines, are marked
+// indirect; pass more entry points, e.g. from traceExecution, to cover the code they reach.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type BasicBlock struct {
+	start, end int // addresses; end is exclusive
+	lines      []DisasmLine
+	succs      []CFGEdge
+	indirect   bool // ends in a jump whose target can't be resolved
+	invalid    bool // runs into a word that isn't a valid instruction, or off the end of the program
+}
+
+type CFGEdge struct {
+	to    int
+	label string
+}
+
+type CFG struct {
+	blocks map[int]*BasicBlock // keyed by start address
+}
+
+// Where control can go after one instruction
+type flow struct {
+	line     DisasmLine
+	valid    bool
+	succs    []CFGEdge
+	indirect bool
+}
+
+func isJump(opcode int) bool {
+	return opcode == 5 || opcode == 6
+}
+
+// Build the control-flow graph of program, starting from address 0 and any extra entries
+func buildCFG(program []int, entries ...int) *CFG {
+	entries = append([]int{0}, entries...)
+
+	// Decode everything reachable. Which position-mode jump targets can be trusted depends on
+	// what the decoded code writes, so decode again until the set of written cells settles.
+	// It only grows, so this ends.
+	written := make(map[int]bool)
+	var decoded map[int]DisasmLine
+	var valid map[int]bool
+	for {
+		decoded, valid = decodeReachable(program, entries, written)
+		grew := false
+		for addr, line := range decoded {
+			info := instructionSet[program[addr]%100]
+			if valid[addr] && info.write > 0 && line.modes[info.write-1] == POS && !written[program[addr+info.write]] {
+				written[program[addr+info.write]] = true
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	// Work out successors, and which addresses start blocks
+	flows := make(map[int]flow)
+	leaders := make(map[int]bool)
+	for _, entry := range entries {
+		leaders[entry] = true
+	}
+	for addr, line := range decoded {
+		f := flow{line: line, valid: valid[addr]}
+		if f.valid {
+			f.succs, f.indirect = successors(program, addr, line, written)
+			opcode := program[addr] % 100
+			if isJump(opcode) {
+				for _, succ := range f.succs {
+					leaders[succ.to] = true
+				}
+			}
+		}
+		flows[addr] = f
+	}
+
+	// Grow a block from each leader until the next leader or the end of straight-line code
+	cfg := &CFG{blocks: make(map[int]*BasicBlock)}
+	for leader := range leaders {
+		if _, ok := flows[leader]; !ok {
+			continue
+		}
+		block := &BasicBlock{start: leader}
+		for addr := leader; ; {
+			f := flows[addr]
+			block.lines = append(block.lines, f.line)
+			block.end = addr + len(f.line.words)
+			if !f.valid {
+				block.invalid = true
+				break
+			}
+			_, decodedNext := flows[block.end]
+			if len(f.succs) != 1 || f.succs[0].label != "" || f.indirect || leaders[block.end] || !decodedNext {
+				block.succs, block.indirect = f.succs, f.indirect
+				break
+			}
+			addr = block.end
+		}
+		// Past the end of the program, memory reads as 0, which isn't an instruction
+		var succs []CFGEdge
+		for _, succ := range block.succs {
+			if _, ok := flows[succ.to]; ok {
+				succs = append(succs, succ)
+			} else {
+				block.invalid = true
+			}
+		}
+		block.succs = succs
+		cfg.blocks[leader] = block
+	}
+	return cfg
+}
+
+// Decode the instructions reachable from entries, following the jump targets that written allows
+func decodeReachable(program []int, entries []int, written map[int]bool) (map[int]DisasmLine, map[int]bool) {
+	decoded := make(map[int]DisasmLine)
+	valid := make(map[int]bool)
+	work := append([]int(nil), entries...)
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		if _, seen := decoded[addr]; seen || addr < 0 || addr >= len(program) {
+			continue
+		}
+		line, ok := decodeInstruction(program, addr)
+		decoded[addr], valid[addr] = line, ok
+		if !ok {
+			continue
+		}
+		opcode := program[addr] % 100
+		if opcode != 99 {
+			work = append(work, addr+len(line.words))
+		}
+		if isJump(opcode) {
+			if target, ok := jumpTarget(program, addr, written); ok {
+				work = append(work, target)
+			}
+		}
+	}
+	return decoded, valid
+}
+
+// Resolve the target of the jump at addr. Position-mode targets are only trusted when
+// written is given and doesn't contain the cell.
+func jumpTarget(program []int, addr int, written map[int]bool) (int, bool) {
+	_, modes := decodeOp(program[addr])
+	param := program[addr+2]
+	switch modes[2] {
+	case DIRECT:
+		return param, true
+	case POS:
+		if written != nil && !written[param] && param >= 0 && param < len(program) {
+			return program[param], true
+		}
+	}
+	return 0, false
+}
+
+// Successor edges of the instruction at addr. Jumps get labelled edges; everything else falls through.
+func successors(program []int, addr int, line DisasmLine, written map[int]bool) (succs []CFGEdge, indirect bool) {
+	opcode := program[addr] % 100
+	next := addr + len(line.words)
+	switch {
+	case opcode == 99:
+		return nil, false
+	case !isJump(opcode):
+		return []CFGEdge{{next, ""}}, false
+	}
+
+	cond := line.operands[0]
+	taken, notTaken := cond+" != 0", cond+" == 0"
+	if opcode == 6 {
+		taken, notTaken = notTaken, taken
+	}
+
+	// An immediate condition makes the jump always or never taken
+	_, modes := decodeOp(program[addr])
+	always, never := false, false
+	if modes[1] == DIRECT {
+		nonzero := program[addr+1] != 0
+		always = nonzero == (opcode == 5)
+		never = !always
+	}
+
+	if !never {
+		if target, ok := jumpTarget(program, addr, written); ok {
+			label := taken
+			if always {
+				label = "always"
+			}
+			succs = append(succs, CFGEdge{target, label})
+		} else {
+			indirect = true
+		}
+	}
+	if !always {
+		label := notTaken
+		if never {
+			label = "always"
+		}
+		succs = append(succs, CFGEdge{next, label})
+	}
+	return succs, indirect
+}
+
+// Block start addresses in order
+func (cfg *CFG) starts() []int {
+	starts := make([]int, 0, len(cfg.blocks))
+	for start := range cfg.blocks {
+		starts = append(starts, start)
+	}
+	sort.Ints(starts)
+	return starts
+}
+
+// Write the graph in Graphviz DOT format. Indirect jumps get a dashed edge to a "?" node.
+func (cfg *CFG) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph intcode {\n")
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	hasIndirect := false
+	for _, start := range cfg.starts() {
+		block := cfg.blocks[start]
+		var label strings.Builder
+		for _, line := range block.lines {
+			label.WriteString(dotEscape(line.String()))
+			label.WriteString(`\l`)
+		}
+		attrs := ""
+		switch {
+		case block.invalid:
+			attrs = ", color=red"
+		case block.indirect:
+			attrs = ", color=orange"
+		}
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\"%s];\n", start, label.String(), attrs)
+		for _, succ := range block.succs {
+			if succ.label == "" {
+				fmt.Fprintf(&b, "\tb%d -> b%d;\n", start, succ.to)
+			} else {
+				fmt.Fprintf(&b, "\tb%d -> b%d [label=\"%s\"];\n", start, succ.to, dotEscape(succ.label))
+			}
+		}
+		if block.indirect {
+			hasIndirect = true
+			fmt.Fprintf(&b, "\tb%d -> unknown [style=dashed];\n", start)
+		}
+	}
+	if hasIndirect {
+		b.WriteString("\tunknown [label=\"?\", shape=circle];\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
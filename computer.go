@@ -12,6 +12,8 @@
 // Opcode 8 is equals: if the first parameter is equal to the second parameter, it stores 1 in the position given by the third parameter. Otherwise, it stores 0.
 // Opcode 9 adjusts the relative base by the value of its only parameter. The relative base increases (or decreases, if the value is negative) by the value of the parameter.
 //
+// Each opcode's layout and handler are looked up in instructionSet; a computer can add experimental opcodes with registerOpcode.
+//
 // Parameter modes:
 // Mode 0, position mode, causes the parameter to be interpreted as a position - if the parameter is 50, its value is the value stored at address 50 in memory.
 // Mode 1, immediate mode, causes a parameter to be interpreted as a value - if the parameter is 50, its value is simply 50.
@@ -20,16 +22,102 @@
 package main
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type IntComputer struct {
-	inputs, outputs, state []int
-	ip                     int // instruction pointer
+	inputs, outputs, state []int // inputs are consumed first-in, first-out; state grows as it is written
+	highWater              int   // highest address loaded or written
+	ip                     int   // instruction pointer
 	relativeBase           int
 	terminated             bool
+	steps                  int                     // instructions executed so far
+	tracer                 Tracer                  // receives a TraceRecord per instruction; may be nil
+	record                 *TraceRecord            // instruction being traced, nil when not tracing
+	codeWatch              *codeWatch              // tracks writes into code; nil unless watchSelfModification was called
+	cache                  []decodedOp             // predecoded instructions by address; nil unless enablePredecode was called
+	source                 InputSource             // consulted once inputs is empty; may be nil
+	sink                   OutputSink              // receives outputs instead of the outputs slice; may be nil
+	customOps              map[int]instructionInfo // opcodes added with registerOpcode; nil if none
+	checked                bool                    // ADD and MUL fail on overflow; set by enableOverflowChecks
+	history                *History                // undo log; nil unless recordHistory was called
+}
+
+// A write into the program's own code, seen by watchSelfModification.
+// Later is false when the address had already been executed at the time of the write,
+// and true when the write came first and the address was executed afterwards.
+type SelfModReport struct {
+	WriterIP int
+	Addr     int
+	Later    bool
+	Count    int // times this writer hit this address
+}
+
+type codeWatch struct {
+	strict   bool
+	executed map[int]bool // addresses of executed instruction words
+	written  map[int]int  // address -> ip of the instruction that last wrote it
+	reports  []SelfModReport
+	index    map[SelfModReport]int // report (with Count 0) -> position in reports
+}
+
+// Undo log kept by recordHistory. Instructions are logged by processOp; reverse.go undoes them.
+type History struct {
+	entries []undoEntry
+	limit   int // most entries kept, or 0 for no limit
+	outputs int // outputs produced since recording started
+}
+
+// How to undo one instruction
+type undoEntry struct {
+	ip, relativeBase, highWater, steps int
+	writes                             []MemWrite // in the order made
+	input                              *int
+	output                             int  // number of the output produced, counting from 0, or -1
+	collected                          bool // the output went to the outputs slice rather than a sink
+}
+
+// Anything that can feed input values to a computer.
+// Read returns false when no value is available.
+type InputSource interface {
+	Read() (int, bool)
+}
+
+// Anything that can accept output values from a computer
+type OutputSink interface {
+	Write(value int)
+}
+
+// Receives a record of each instruction a computer executes, once attached with attachTracer
+type Tracer interface {
+	Trace(record TraceRecord)
+}
+
+// What one instruction did. For write parameters, Operands holds the address written.
+// Reads lists the addresses that position and relative mode value parameters read from.
+type TraceRecord struct {
+	Step     int         `json:"step"` // counts from 1
+	IP       int         `json:"ip"`
+	Opcode   int         `json:"opcode"`
+	Mnemonic string      `json:"mnemonic"`
+	Modes    []ParamMode `json:"modes"`
+	Operands []int       `json:"operands"`
+	Reads    []int       `json:"reads,omitempty"`
+	Writes   []MemWrite  `json:"writes,omitempty"`
+	Input    *int        `json:"input,omitempty"`
+	Output   *int        `json:"output,omitempty"`
+}
+
+type MemWrite struct {
+	Addr int `json:"addr"`
+	Old  int `json:"old"`
+	New  int `json:"new"`
 }
 
 type ParamMode int
@@ -40,35 +128,118 @@ const (
 	RELATIVE
 )
 
-var computer_ram int = 20000
+// Reasons a computer stops running
+type StopReason int
 
-// Converts a computer state string into a slice of integer opcodes and parameters
-func initComputer(state string, ins []int) (computer IntComputer) {
-	log.Debugf("New computer: %#v", state)
-	log.Debugf("Inputs: %#v", ins)
+const (
+	Halted     StopReason = iota // executed opcode 99
+	NeedsInput                   // about to read input, but none is queued
+	Output                       // just wrote an output value
+)
+
+func (reason StopReason) String() string {
+	switch reason {
+	case Halted:
+		return "Halted"
+	case NeedsInput:
+		return "NeedsInput"
+	case Output:
+		return "Output"
+	}
+	return "StopReason(" + strconv.Itoa(int(reason)) + ")"
+}
 
-	computer.inputs = ins
+// Kinds of computer failure. Use errors.Is to test for them.
+var (
+	ErrUnknownOpcode     = errors.New("unknown opcode")
+	ErrBadParamMode      = errors.New("bad parameter mode")
+	ErrAddressOutOfRange = errors.New("address out of range")
+	ErrParse             = errors.New("can't parse program")
+	ErrSelfModifyingCode = errors.New("self-modifying code")
+	ErrBudgetExceeded    = errors.New("execution budget exceeded")
+	ErrOverflow          = errors.New("integer overflow")
+	ErrNoInput           = errors.New("needs input it doesn't have")
+)
 
-	computer.ip = 0
+// The arithmetic that overflowed under enableOverflowChecks. It is the Err of a ComputerError,
+// and matches ErrOverflow with errors.Is.
+type OverflowError struct {
+	Opcode int // 1 for ADD, 2 for MUL
+	A, B   int
+}
 
-	inst := strings.Split(state, ",")
-	//computer.state = make([]int, len(inst))
-	computer.state = make([]int, computer_ram)
+func (e *OverflowError) Error() string {
+	op := "+"
+	if e.Opcode == 2 {
+		op = "*"
+	}
+	return fmt.Sprintf("%v: %d %s %d doesn't fit in %d bits", ErrOverflow, e.A, op, e.B, strconv.IntSize)
+}
+
+func (e *OverflowError) Is(target error) bool {
+	return target == ErrOverflow
+}
+
+// Error raised by a computer, along with where it happened.
+// For ErrParse, IP is the index of the offending value in the program text.
+type ComputerError struct {
+	Err          error // one of the Err* kinds above, or an *OverflowError
+	IP           int
+	Opcode       int // raw value at IP, parameter modes included
+	RelativeBase int
+	Detail       string
+}
+
+func (e *ComputerError) Error() string {
+	msg := fmt.Sprintf("%v at ip=%d (opcode %d, relative base %d)", e.Err, e.IP, e.Opcode, e.RelativeBase)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *ComputerError) Unwrap() error {
+	return e.Err
+}
+
+// Build a ComputerError describing the instruction the computer is currently on
+func computerError(kind error, computer *IntComputer, detail string) error {
+	e := &ComputerError{Err: kind, IP: computer.ip, RelativeBase: computer.relativeBase, Detail: detail}
+	if computer.ip >= 0 && computer.ip < len(computer.state) {
+		e.Opcode = computer.state[computer.ip]
+	}
+	return e
+}
+
+// Largest address space a computer may use. Memory is only allocated as the program writes to it.
+var computer_ram int = 1 << 24
+
+// Converts a computer state string into a slice of integer opcodes and parameters
+func initComputer(state string, ins []int) (*IntComputer, error) {
+
+	computer := &IntComputer{inputs: ins}
+
+	inst := strings.Split(strings.TrimSpace(state), ",")
+	if len(inst) > computer_ram {
+		return computer, &ComputerError{Err: ErrParse, Detail: fmt.Sprintf("program has %d values, memory holds %d", len(inst), computer_ram)}
+	}
+	computer.state = make([]int, len(inst))
+	computer.highWater = len(inst) - 1
 	for id, item := range inst {
-		opcode, err := strconv.Atoi(item)
+		opcode, err := strconv.Atoi(strings.TrimSpace(item))
 		if err != nil {
-			log.Fatal("Can't convert instruction to int")
+			return computer, &ComputerError{Err: ErrParse, IP: id, Detail: fmt.Sprintf("%q is not an integer", item)}
 		}
 		computer.state[id] = opcode
 	}
 
-	return computer
+	return computer, nil
 }
 
-// Return current state of computer as a string
-func snapshotComputer(computer IntComputer) (int, string) {
-	strCode := make([]string, len(computer.state))
-	for id, item := range computer.state {
+// Return current state of computer as a string, up to the highest address loaded or written
+func snapshotComputer(computer *IntComputer) (int, string) {
+	strCode := make([]string, computer.highWater+1)
+	for id, item := range computer.state[:computer.highWater+1] {
 		strCode[id] = strconv.Itoa(item)
 	}
 
@@ -79,215 +250,636 @@ func snapshotComputer(computer IntComputer) (int, string) {
 	return output, strings.Join(strCode, ",")
 }
 
-// Given a computer, run the program it contains
-func run(computer IntComputer) IntComputer {
-	//log.Printf("In: %d, Out: %d, Computer: %#v", input, output, computer)
-	op := computer.state[computer.ip]
+// Given a computer, run the program it contains until it halts or needs input
+func run(computer *IntComputer) error {
+	_, err := execute(computer, false, nil)
+	return err
+}
+
+// Like run, for callers that queue all the input up front: stopping for more fails with ErrNoInput
+func runToHalt(computer *IntComputer) error {
+	if err := run(computer); err != nil {
+		return err
+	}
+	if !computer.terminated {
+		return computerError(ErrNoInput, computer, "")
+	}
+	return nil
+}
+
+// Given a computer, execute the next instruction.
+// A computer waiting for input is left unchanged.
+func runStep(computer *IntComputer) error {
+	op, err := fetch(computer)
+	if err != nil {
+		return err
+	}
 	if op == 99 {
-		computer.terminated = true
-		return computer
+		halt(computer)
+		return nil
+	}
+	pullInput(computer)
+	if needsInput(computer) {
+		return nil
 	}
 
-	computer = processOp(op, computer)
-	computer = run(computer)
+	return processOp(op, computer)
+}
 
-	return computer
+// Run the computer until it halts, needs input it doesn't have, or writes an output.
+// Calling resume again after queueing input (or consuming output) picks up where it stopped.
+func resume(computer *IntComputer) (StopReason, error) {
+	return execute(computer, true, nil)
 }
 
-// Given a computer, execute the next instruction
-func runStep(computer IntComputer) IntComputer {
-	op := computer.state[computer.ip]
-	if op == 99 {
-		computer.terminated = true
-		return computer
+// Limits on one runContext or resumeContext call. Zero fields mean no limit.
+type Budget struct {
+	maxSteps int       // instructions the call may execute
+	deadline time.Time // wall-clock time by which the call must stop
+}
+
+// Like run, but stops with ErrBudgetExceeded when ctx is done or budget runs out.
+// The computer is then left between instructions, so it can be inspected or run again.
+func runContext(ctx context.Context, computer *IntComputer, budget Budget) error {
+	_, err := execute(computer, false, newLimiter(ctx, computer, budget))
+	return err
+}
+
+// Like resume, with the limits of runContext
+func resumeContext(ctx context.Context, computer *IntComputer, budget Budget) (StopReason, error) {
+	return execute(computer, true, newLimiter(ctx, computer, budget))
+}
+
+// Instructions between checks of the context and the clock, which cost far more than an instruction
+const limitCheckInterval = 1024
+
+// Enforces a Budget and a context during one call
+type limiter struct {
+	ctx       context.Context
+	stepLimit int // value of computer.steps to stop at, or -1
+	deadline  time.Time
+	countdown int // instructions until the next context and clock check
+}
+
+func newLimiter(ctx context.Context, computer *IntComputer, budget Budget) *limiter {
+	l := &limiter{ctx: ctx, stepLimit: -1, deadline: budget.deadline}
+	if budget.maxSteps > 0 {
+		l.stepLimit = computer.steps + budget.maxSteps
 	}
+	return l
+}
 
-	return processOp(op, computer)
+// Fail with ErrBudgetExceeded if the computer must stop before its next instruction
+func (l *limiter) check(computer *IntComputer) error {
+	if l.stepLimit >= 0 && computer.steps >= l.stepLimit {
+		return computerError(ErrBudgetExceeded, computer, fmt.Sprintf("step limit of %d reached", l.stepLimit))
+	}
+	if l.countdown--; l.countdown > 0 {
+		return nil
+	}
+	l.countdown = limitCheckInterval
+	if err := l.ctx.Err(); err != nil {
+		return computerError(ErrBudgetExceeded, computer, err.Error())
+	}
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		return computerError(ErrBudgetExceeded, computer, "deadline passed")
+	}
+	return nil
+}
+
+// The loop behind run and resume. With untilOutput, it also stops after each output.
+// limits may be nil.
+func execute(computer *IntComputer, untilOutput bool, limits *limiter) (StopReason, error) {
+	for {
+		if limits != nil {
+			if err := limits.check(computer); err != nil {
+				return Halted, err
+			}
+		}
+		if computer.cache != nil && execCached(computer) {
+			continue
+		}
+		op, err := fetch(computer)
+		if err != nil {
+			return Halted, err
+		}
+		if op == 99 {
+			halt(computer)
+			return Halted, nil
+		}
+		pullInput(computer)
+		if needsInput(computer) {
+			return NeedsInput, nil
+		}
+
+		if err := processOp(op, computer); err != nil {
+			return Halted, err
+		}
+		if untilOutput && op%100 == 4 {
+			return Output, nil
+		}
+	}
 }
 
-func willTerminate(computer IntComputer) bool {
-	return computer.state[computer.ip] == 99
+// Stop at the HALT at the instruction pointer. The tracer sees it the first time, like any
+// other instruction, though it doesn't count as a step.
+func halt(computer *IntComputer) {
+	if computer.tracer != nil && !computer.terminated {
+		computer.tracer.Trace(TraceRecord{Step: computer.steps + 1, IP: computer.ip, Opcode: 99, Mnemonic: "HALT"})
+	}
+	computer.terminated = true
 }
 
-func opAdd(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opAdd (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
-	var pdest int
-	if pm[3] == RELATIVE {
-		pdest = computer.relativeBase + computer.state[pc+3]
-	} else {
-		pdest = computer.state[pc+3]
+// Queue input values, to be read in the order given
+func addInput(computer *IntComputer, values ...int) {
+	computer.inputs = append(computer.inputs, values...)
+}
+
+// Read from source once the queued inputs run out
+func attachInput(computer *IntComputer, source InputSource) {
+	computer.source = source
+}
+
+// Send outputs to sink instead of collecting them in the outputs slice
+func attachOutput(computer *IntComputer, sink OutputSink) {
+	computer.sink = sink
+}
+
+// Report every instruction executed to tracer. Pass nil to stop tracing.
+func attachTracer(computer *IntComputer, tracer Tracer) {
+	computer.tracer = tracer
+}
+
+// Start flagging writes to addresses that are executed as instructions, before or after the write.
+// In strict mode, such writes (and executing an address written earlier) fail with ErrSelfModifyingCode.
+func watchSelfModification(computer *IntComputer, strict bool) {
+	computer.codeWatch = &codeWatch{
+		strict:   strict,
+		executed: make(map[int]bool),
+		written:  make(map[int]int),
+		index:    make(map[SelfModReport]int),
+	}
+}
+
+// Writes into code seen since watchSelfModification, in the order first seen
+func selfModifications(computer *IntComputer) []SelfModReport {
+	if computer.codeWatch == nil {
+		return nil
+	}
+	return computer.codeWatch.reports
+}
+
+func (watch *codeWatch) report(writerIP, addr int, later bool) {
+	key := SelfModReport{WriterIP: writerIP, Addr: addr, Later: later}
+	if i, ok := watch.index[key]; ok {
+		watch.reports[i].Count++
+		return
+	}
+	watch.index[key] = len(watch.reports)
+	key.Count = 1
+	watch.reports = append(watch.reports, key)
+}
+
+// Registers of the computer before the instruction at its instruction pointer runs
+func beginUndo(computer *IntComputer) undoEntry {
+	return undoEntry{
+		ip:           computer.ip,
+		relativeBase: computer.relativeBase,
+		highWater:    computer.highWater,
+		steps:        computer.steps,
+		output:       -1,
+	}
+}
+
+// Log an instruction, given its registers from beginUndo and the record of what it did.
+// An instruction that failed is only logged if it changed something before failing.
+func (h *History) log(entry undoEntry, record *TraceRecord, collected bool, ok bool) {
+	if !ok && len(record.Writes) == 0 && record.Input == nil && record.Output == nil {
+		return
+	}
+	entry.writes = record.Writes
+	entry.input = record.Input
+	if record.Output != nil {
+		entry.output = h.outputs
+		entry.collected = collected
+		h.outputs++
+	}
+	h.entries = append(h.entries, entry)
+	if h.limit > 0 && len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+}
+
+// Number of words in an instruction on computer, opcode included
+func instructionSize(computer *IntComputer, opcode int) int {
+	info, _ := lookupInstruction(computer, opcode)
+	return info.params + 1
+}
+
+// Mark the instruction at the instruction pointer as executed, reporting any of its words written earlier
+func checkCodeWrites(computer *IntComputer, opcode int) error {
+	watch := computer.codeWatch
+	for addr := computer.ip; addr < computer.ip+instructionSize(computer, opcode); addr++ {
+		if writerIP, ok := watch.written[addr]; ok {
+			watch.report(writerIP, addr, true)
+			if watch.strict {
+				return computerError(ErrSelfModifyingCode, computer, fmt.Sprintf("address %d was written by the instruction at %d", addr, writerIP))
+			}
+			delete(watch.written, addr)
+		}
+		watch.executed[addr] = true
+	}
+	return nil
+}
+
+// Check a write to addr by the current instruction against the code executed so far
+func checkDataWrite(computer *IntComputer, addr int) error {
+	watch := computer.codeWatch
+	if watch.executed[addr] {
+		watch.report(computer.ip, addr, false)
+		if watch.strict {
+			return computerError(ErrSelfModifyingCode, computer, fmt.Sprintf("write to executed address %d", addr))
+		}
+	}
+	watch.written[addr] = computer.ip
+	return nil
+}
+
+// Remove and return the oldest collected output, if any
+func popOutput(computer *IntComputer) (int, bool) {
+	if len(computer.outputs) == 0 {
+		return 0, false
+	}
+	output := computer.outputs[0]
+	computer.outputs = computer.outputs[1:]
+	return output, true
+}
+
+// Read the instruction at the instruction pointer
+func fetch(computer *IntComputer) (int, error) {
+	if computer.ip < 0 || computer.ip >= computer_ram {
+		return 0, computerError(ErrAddressOutOfRange, computer, fmt.Sprintf("instruction pointer %d", computer.ip))
+	}
+	return peek(computer, computer.ip), nil
+}
+
+// Read memory without bounds errors; cells never written read as 0
+func peek(computer *IntComputer, addr int) int {
+	if addr < 0 || addr >= len(computer.state) {
+		return 0
+	}
+	return computer.state[addr]
+}
+
+// Length to grow a memory of length cells to so it holds addr: double, or more if needed, up to computer_ram
+func grownSize(length, addr int) int {
+	size := 2 * length
+	if size <= addr {
+		size = addr + 1
+	}
+	if size > computer_ram {
+		size = computer_ram
+	}
+	return size
+}
+
+// Write memory, growing it as needed. addr must already be checked against computer_ram.
+func store(computer *IntComputer, addr, value int) {
+	if addr >= len(computer.state) {
+		size := grownSize(len(computer.state), addr)
+		grown := make([]int, size)
+		copy(grown, computer.state)
+		computer.state = grown
+		if computer.cache != nil {
+			grownCache := make([]decodedOp, size)
+			copy(grownCache, computer.cache)
+			computer.cache = grownCache
+		}
+	}
+	if addr < len(computer.cache) {
+		computer.cache[addr].valid = false
+	}
+	if computer.record != nil {
+		computer.record.Writes = append(computer.record.Writes, MemWrite{addr, peek(computer, addr), value})
+	}
+	computer.state[addr] = value
+	if addr > computer.highWater {
+		computer.highWater = addr
+	}
+}
+
+// Write an instruction's result to addr. A self-modification watch checks and records the
+// write here, as it lands, so writes by instructions that fail earlier aren't counted.
+func writeResult(computer *IntComputer, addr, value int) error {
+	if computer.codeWatch != nil {
+		if err := checkDataWrite(computer, addr); err != nil {
+			return err
+		}
+	}
+	store(computer, addr, value)
+	return nil
+}
+
+func willTerminate(computer *IntComputer) bool {
+	op, err := fetch(computer)
+	return err == nil && op == 99
+}
+
+// True when the next instruction reads input and none is queued
+func needsInput(computer *IntComputer) bool {
+	op, err := fetch(computer)
+	if err != nil {
+		return false
+	}
+	return op%100 == 3 && len(computer.inputs) == 0
+}
+
+// If the next instruction reads input and none is queued, try to pull a value from the input source
+func pullInput(computer *IntComputer) {
+	if computer.source == nil || !needsInput(computer) {
+		return
+	}
+	if input, ok := computer.source.Read(); ok {
+		computer.inputs = append(computer.inputs, input)
+	}
+}
+
+// Make ADD and MUL fail with an OverflowError, at the faulting instruction, instead of wrapping around
+func enableOverflowChecks(computer *IntComputer) {
+	computer.checked = true
+}
+
+// True when ADD (opcode 1) or MUL (opcode 2) of a and b wraps around
+func overflows(opcode, a, b int) bool {
+	switch opcode {
+	case 1:
+		return (b > 0 && a > math.MaxInt-b) || (b < 0 && a < math.MinInt-b)
+	case 2:
+		if a == 0 || b == 0 {
+			return false
+		}
+		return (a*b)/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt)
+	}
+	return false
+}
+
+// Fail if the computer checks for overflow and ADD or MUL of a and b overflows
+func checkOverflow(computer *IntComputer, opcode, a, b int) error {
+	if computer.checked && overflows(opcode, a, b) {
+		return computerError(&OverflowError{opcode, a, b}, computer, "")
+	}
+	return nil
+}
+
+func opAdd(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, pdest, err := getParams3(pm, computer)
+	if err != nil {
+		return err
+	}
+	if err := checkOverflow(computer, 1, p1, p2); err != nil {
+		return err
+	}
+	if err := writeResult(computer, pdest, p1+p2); err != nil {
+		return err
 	}
-	log.Debugf("opAdd %d(@%d) + %d(@%d) into loc %d\n", p1, pc+1, p2, pc+2, pdest)
-	computer.state[pdest] = p1 + p2
 	computer.ip += 4
-	return computer
+	return nil
 }
 
-func opMult(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opMult (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
-	var pdest int
-	if pm[3] == RELATIVE {
-		pdest = computer.relativeBase + computer.state[pc+3]
-	} else {
-		pdest = computer.state[pc+3]
+func opMult(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, pdest, err := getParams3(pm, computer)
+	if err != nil {
+		return err
+	}
+	if err := checkOverflow(computer, 2, p1, p2); err != nil {
+		return err
+	}
+	if err := writeResult(computer, pdest, p1*p2); err != nil {
+		return err
 	}
-	log.Debugf("opMult %d(@%d) + %d(@%d) into %d\n", p1, pc+1, p2, pc+2, pc+3)
-	computer.state[pdest] = p1 * p2
 	computer.ip += 4
-	return computer
+	return nil
 }
 
-func opReadInput(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opReadInput (ip=%d)", computer.ip)
+func opReadInput(pm [4]ParamMode, computer *IntComputer) error {
 	pc := computer.ip
-	var pdest int
-	if pm[1] == RELATIVE {
-		pdest = computer.relativeBase + computer.state[pc+1]
-	} else {
-		pdest = computer.state[pc+1]
+	pdest, err := getParamAddr(pm[1], pc+1, computer)
+	if err != nil {
+		return err
 	}
 
-	// Try to read input
-	var input int
-	if len(computer.inputs) > 0 {
-		// Pop an input value
-		n_inputs := len(computer.inputs)
-		input, computer.inputs = computer.inputs[n_inputs-1], computer.inputs[:n_inputs-1]
-		log.Debugf("Read input value %d\n", input)
+	// Take the oldest input value; run and resume never get here with an empty queue.
+	// It stays queued if the write is refused.
+	input := computer.inputs[0]
+	if err := writeResult(computer, pdest, input); err != nil {
+		return err
+	}
+	computer.inputs = computer.inputs[1:]
+	if computer.record != nil {
+		computer.record.Input = &input
 	}
-
-	computer.state[pdest] = input
 	computer.ip += 2
-	return computer
+	return nil
 }
 
-func opWriteOutput(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opWriteOutput (ip=%d)", computer.ip)
+func opWriteOutput(pm [4]ParamMode, computer *IntComputer) error {
 	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	log.Debugf("Wrote output: %#v\n", p1)
-	computer.outputs = append(computer.outputs, p1)
+	p1, err := getParamValue(pm[1], pc+1, computer)
+	if err != nil {
+		return err
+	}
+	if computer.record != nil {
+		computer.record.Output = &p1
+	}
+	if computer.sink != nil {
+		computer.sink.Write(p1)
+	} else {
+		computer.outputs = append(computer.outputs, p1)
+	}
 	computer.ip += 2
-	return computer
+	return nil
 }
 
-func opJumpIfTrue(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opJumpIfTrue (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
+func opJumpIfTrue(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, err := getParams2(pm, computer)
+	if err != nil {
+		return err
+	}
 	if p1 != 0 {
 		computer.ip = p2
 	} else {
 		computer.ip += 3
 	}
 
-	return computer
+	return nil
 }
 
-func opJumpIfFalse(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opJumpIfFalse (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
-	log.Debugf("opJumpIfFalse p1=%d, p2=%d", p1, p2)
+func opJumpIfFalse(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, err := getParams2(pm, computer)
+	if err != nil {
+		return err
+	}
 	if p1 == 0 {
 		computer.ip = p2
 	} else {
 		computer.ip += 3
 	}
 
-	return computer
+	return nil
 }
 
-func opLessThan(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opLessThan (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
-	var pdest int
-	if pm[3] == RELATIVE {
-		pdest = computer.relativeBase + computer.state[pc+3]
-	} else {
-		pdest = computer.state[pc+3]
+func opLessThan(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, pdest, err := getParams3(pm, computer)
+	if err != nil {
+		return err
 	}
+	result := 0
 	if p1 < p2 {
-		computer.state[pdest] = 1
-	} else {
-		computer.state[pdest] = 0
+		result = 1
+	}
+	if err := writeResult(computer, pdest, result); err != nil {
+		return err
 	}
 	computer.ip += 4
 
-	return computer
+	return nil
 }
 
-func opEquals(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opEquals (ip=%d)", computer.ip)
-	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	p2 := getParamValue(pm[2], pc+2, computer)
-	var pdest int
-	if pm[3] == RELATIVE {
-		pdest = computer.relativeBase + computer.state[pc+3]
-	} else {
-		pdest = computer.state[pc+3]
+func opEquals(pm [4]ParamMode, computer *IntComputer) error {
+	p1, p2, pdest, err := getParams3(pm, computer)
+	if err != nil {
+		return err
 	}
+	result := 0
 	if p1 == p2 {
-		computer.state[pdest] = 1
-	} else {
-		computer.state[pdest] = 0
+		result = 1
+	}
+	if err := writeResult(computer, pdest, result); err != nil {
+		return err
 	}
 	computer.ip += 4
 
-	return computer
+	return nil
 }
 
-func opSetRelativeBase(pm [4]ParamMode, computer IntComputer) IntComputer {
-	log.Debugf("opSetRelativeBase (ip=%d)", computer.ip)
+func opSetRelativeBase(pm [4]ParamMode, computer *IntComputer) error {
 	pc := computer.ip
-	p1 := getParamValue(pm[1], pc+1, computer)
-	log.Debugf("relativeBase = %d", p1)
+	p1, err := getParamValue(pm[1], pc+1, computer)
+	if err != nil {
+		return err
+	}
 	computer.relativeBase += p1
 	computer.ip += 2
 
-	return computer
+	return nil
 }
 
-func processOp(op int, computer IntComputer) IntComputer {
-	log.Debugf("State: %#v", computer.state)
+// Executes an instruction, given the parameter modes decoded from its opcode (pm[1] to pm[3]).
+// It reads its parameters with getParamValue and getParamAddr, so they are checked and traced,
+// writes memory with store, and moves the instruction pointer on.
+type OpHandler func(pm [4]ParamMode, computer *IntComputer) error
 
-	opcode, paramModes := decodeOp(op)
+// Mnemonic, operand layout and implementation of an instruction
+type instructionInfo struct {
+	name   string
+	params int
+	write  int       // which parameter (1-3) is written to, or 0 if none
+	exec   OpHandler // nil for HALT, which the run loops handle themselves
+}
 
-	switch opcode {
-	case 1:
-		computer = opAdd(paramModes, computer)
-	case 2:
-		computer = opMult(paramModes, computer)
-	case 3:
-		computer = opReadInput(paramModes, computer)
-	case 4:
-		computer = opWriteOutput(paramModes, computer)
-	case 5:
-		computer = opJumpIfTrue(paramModes, computer)
-	case 6:
-		computer = opJumpIfFalse(paramModes, computer)
-	case 7:
-		computer = opLessThan(paramModes, computer)
-	case 8:
-		computer = opEquals(paramModes, computer)
-	case 9:
-		computer = opSetRelativeBase(paramModes, computer)
-	default:
-		log.Fatal("Unexpected opcode!")
+// The built-in instructions by opcode, shared by every computer
+var instructionSet = map[int]instructionInfo{
+	1:  {"ADD", 3, 3, opAdd},
+	2:  {"MUL", 3, 3, opMult},
+	3:  {"IN", 1, 1, opReadInput},
+	4:  {"OUT", 1, 0, opWriteOutput},
+	5:  {"JT", 2, 0, opJumpIfTrue},
+	6:  {"JF", 2, 0, opJumpIfFalse},
+	7:  {"LT", 3, 3, opLessThan},
+	8:  {"EQ", 3, 3, opEquals},
+	9:  {"ARB", 1, 0, opSetRelativeBase},
+	99: {"HALT", 0, 0, nil},
+}
+
+// instructionSet indexed by opcode, so the run loops don't pay for a map lookup per instruction
+var builtinOps [100]*instructionInfo
+
+func init() {
+	for opcode, info := range instructionSet {
+		info := info
+		builtinOps[opcode] = &info
 	}
+}
 
-	return computer
+// Add an experimental instruction to one computer. It can't replace a built-in instruction,
+// and isn't kept by saveComputer, so register it again after loadComputer.
+func registerOpcode(computer *IntComputer, opcode int, info instructionInfo) error {
+	_, builtin := instructionSet[opcode]
+	switch {
+	case opcode <= 0 || opcode >= 99:
+		return fmt.Errorf("opcode %d is not between 1 and 98", opcode)
+	case builtin:
+		return fmt.Errorf("opcode %d is already %s", opcode, instructionSet[opcode].name)
+	case info.name == "" || info.exec == nil:
+		return fmt.Errorf("opcode %d needs a name and a handler", opcode)
+	case info.params < 0 || info.params > 3 || info.write < 0 || info.write > info.params:
+		return fmt.Errorf("opcode %d has a bad layout: %d parameters, writing parameter %d", opcode, info.params, info.write)
+	}
+	if computer.customOps == nil {
+		computer.customOps = make(map[int]instructionInfo)
+	}
+	computer.customOps[opcode] = info
+	return nil
+}
+
+// The instruction opcode stands for on computer: one of its custom opcodes or a built-in one.
+// computer may be nil, for the built-in instructions only.
+func lookupInstruction(computer *IntComputer, opcode int) (instructionInfo, bool) {
+	if computer != nil && computer.customOps != nil {
+		if info, ok := computer.customOps[opcode]; ok {
+			return info, true
+		}
+	}
+	if opcode < 0 || opcode >= len(builtinOps) || builtinOps[opcode] == nil {
+		return instructionInfo{}, false
+	}
+	return *builtinOps[opcode], true
+}
+
+// Execute the instruction op, found at the instruction pointer
+func processOp(op int, computer *IntComputer) error {
+	opcode, paramModes := decodeOp(op)
+	if computer.codeWatch != nil {
+		if err := checkCodeWrites(computer, opcode); err != nil {
+			return err
+		}
+	}
+	info, ok := lookupInstruction(computer, opcode)
+	if !ok || info.exec == nil {
+		return computerError(ErrUnknownOpcode, computer, "")
+	}
+	var undo undoEntry
+	if computer.history != nil {
+		undo = beginUndo(computer)
+	}
+	if computer.tracer != nil || computer.history != nil {
+		computer.record = &TraceRecord{Step: computer.steps + 1, IP: computer.ip, Opcode: opcode, Mnemonic: info.name}
+	}
+
+	err := info.exec(paramModes, computer)
+	if err == nil {
+		computer.steps++
+	}
+	if computer.record != nil {
+		if err == nil && computer.tracer != nil {
+			computer.tracer.Trace(*computer.record)
+		}
+		if computer.history != nil {
+			computer.history.log(undo, computer.record, computer.sink == nil, err == nil)
+		}
+		computer.record = nil
+	}
+	return err
 }
 
 func decodeOp(op int) (opcode int, paramModes [4]ParamMode) {
@@ -307,18 +899,240 @@ func decodeOp(op int) (opcode int, paramModes [4]ParamMode) {
 	return
 }
 
-func getParamValue(mode ParamMode, loc int, computer IntComputer) int {
+// Read the memory cell at addr, checking it is addressable
+func readAddr(addr int, computer *IntComputer) (int, error) {
+	if addr < 0 || addr >= computer_ram {
+		return 0, computerError(ErrAddressOutOfRange, computer, fmt.Sprintf("address %d", addr))
+	}
+	return peek(computer, addr), nil
+}
+
+// Resolve a value parameter, according to its mode
+func getParamValue(mode ParamMode, loc int, computer *IntComputer) (int, error) {
+	value, err := resolveParamValue(mode, loc, computer)
+	if err == nil && computer.record != nil {
+		traceOperand(computer, mode, value)
+		if mode != DIRECT {
+			addr := peek(computer, loc)
+			if mode == RELATIVE {
+				addr += computer.relativeBase
+			}
+			computer.record.Reads = append(computer.record.Reads, addr)
+		}
+	}
+	return value, err
+}
+
+func resolveParamValue(mode ParamMode, loc int, computer *IntComputer) (int, error) {
 	switch mode {
 	case POS:
-		log.Debug("POS param at ", loc)
-		return computer.state[computer.state[loc]]
+		addr, err := readAddr(loc, computer)
+		if err != nil {
+			return 0, err
+		}
+		return readAddr(addr, computer)
 	case DIRECT:
-		log.Debug("DIRECT param at ", loc)
-		return computer.state[loc]
+		return readAddr(loc, computer)
+	case RELATIVE:
+		offset, err := readAddr(loc, computer)
+		if err != nil {
+			return 0, err
+		}
+		return readAddr(computer.relativeBase+offset, computer)
+	}
+	return 0, computerError(ErrBadParamMode, computer, fmt.Sprintf("mode %d for parameter at %d", mode, loc))
+}
+
+// Resolve the address a write parameter points at. Immediate mode can't be written to.
+func getParamAddr(mode ParamMode, loc int, computer *IntComputer) (int, error) {
+	param, err := readAddr(loc, computer)
+	if err != nil {
+		return 0, err
+	}
+	addr, err := paramAddr(mode, loc, param, computer.relativeBase, func(kind error, detail string) error {
+		return computerError(kind, computer, detail)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if computer.record != nil {
+		traceOperand(computer, mode, addr)
+	}
+	return addr, nil
+}
+
+// The address a position or relative mode parameter at loc, holding param, points at.
+// fail builds the error for a bad mode or an address out of range.
+func paramAddr(mode ParamMode, loc, param, relativeBase int, fail func(kind error, detail string) error) (int, error) {
+	addr := param
+	switch mode {
+	case POS:
 	case RELATIVE:
-		log.Debug("RELATIVE param at ", computer.relativeBase+computer.state[loc])
-		return computer.state[computer.relativeBase+computer.state[loc]]
+		addr += relativeBase
+	default:
+		return 0, fail(ErrBadParamMode, fmt.Sprintf("mode %d for write parameter at %d", mode, loc))
+	}
+	if addr < 0 || addr >= computer_ram {
+		return 0, fail(ErrAddressOutOfRange, fmt.Sprintf("address %d", addr))
+	}
+	return addr, nil
+}
+
+func traceOperand(computer *IntComputer, mode ParamMode, value int) {
+	computer.record.Modes = append(computer.record.Modes, mode)
+	computer.record.Operands = append(computer.record.Operands, value)
+}
+
+// Read the two value parameters of a jump instruction
+func getParams2(pm [4]ParamMode, computer *IntComputer) (p1, p2 int, err error) {
+	pc := computer.ip
+	if p1, err = getParamValue(pm[1], pc+1, computer); err != nil {
+		return
+	}
+	p2, err = getParamValue(pm[2], pc+2, computer)
+	return
+}
+
+// Read the two value parameters and the destination address of an arithmetic or comparison instruction
+func getParams3(pm [4]ParamMode, computer *IntComputer) (p1, p2, pdest int, err error) {
+	if p1, p2, err = getParams2(pm, computer); err != nil {
+		return
+	}
+	pdest, err = getParamAddr(pm[3], computer.ip+3, computer)
+	return
+}
+
+// An instruction decoded once and cached by the address it was found at. Kept small, since
+// there is one per memory cell. Opcodes and modes that don't fit never take the fast path anyway.
+type decodedOp struct {
+	valid  bool
+	opcode uint8
+	modes  [4]uint8
+}
+
+// Cache decoded instructions, so loops don't decode the same instructions over and over.
+// A cache entry is dropped when its address is written. Arithmetic, comparison, jump and
+// relative base instructions then run on a fast path; anything unusual (input, output,
+// memory growth, errors, tracing, watching for self-modification) takes the normal path,
+// so results are exactly the same.
+func enablePredecode(computer *IntComputer) {
+	computer.cache = make([]decodedOp, len(computer.state))
+}
+
+// Value of a parameter, if it can be read without growing memory or raising an error
+func fastValue(computer *IntComputer, mode ParamMode, loc int) (int, bool) {
+	state := computer.state
+	if loc >= len(state) {
+		return 0, false
+	}
+	var addr int
+	switch mode {
+	case POS:
+		addr = state[loc]
+	case DIRECT:
+		return state[loc], true
+	case RELATIVE:
+		addr = computer.relativeBase + state[loc]
+	default:
+		return 0, false
+	}
+	if addr < 0 || addr >= len(state) {
+		return 0, false
+	}
+	return state[addr], true
+}
+
+// Address a write parameter points at, if it is already allocated
+func fastAddr(computer *IntComputer, mode ParamMode, loc int) (int, bool) {
+	state := computer.state
+	if loc >= len(state) {
+		return 0, false
+	}
+	var addr int
+	switch mode {
+	case POS:
+		addr = state[loc]
+	case RELATIVE:
+		addr = computer.relativeBase + state[loc]
+	default:
+		return 0, false
+	}
+	return addr, addr >= 0 && addr < len(state)
+}
+
+// Execute the instruction at the instruction pointer from the cache.
+// Returns false, having changed nothing, when it must go through processOp instead.
+func execCached(computer *IntComputer) bool {
+	ip := computer.ip
+	if ip < 0 || ip >= len(computer.cache) || computer.tracer != nil || computer.codeWatch != nil || computer.history != nil {
+		return false
+	}
+	d := &computer.cache[ip]
+	if !d.valid {
+		opcode, modes := decodeOp(computer.state[ip])
+		if opcode < 0 || opcode > 9 {
+			return false
+		}
+		d.opcode = uint8(opcode)
+		for p := 1; p < 4; p++ {
+			d.modes[p] = uint8(modes[p]) // decodeOp gives single digits
+		}
+		d.valid = true
+	}
+
+	switch d.opcode {
+	case 1, 2, 7, 8:
+		p1, ok1 := fastValue(computer, ParamMode(d.modes[1]), ip+1)
+		p2, ok2 := fastValue(computer, ParamMode(d.modes[2]), ip+2)
+		pdest, ok3 := fastAddr(computer, ParamMode(d.modes[3]), ip+3)
+		if !ok1 || !ok2 || !ok3 {
+			return false
+		}
+		if computer.checked && overflows(int(d.opcode), p1, p2) {
+			return false
+		}
+		var result int
+		switch d.opcode {
+		case 1:
+			result = p1 + p2
+		case 2:
+			result = p1 * p2
+		case 7:
+			if p1 < p2 {
+				result = 1
+			}
+		case 8:
+			if p1 == p2 {
+				result = 1
+			}
+		}
+		computer.state[pdest] = result
+		computer.cache[pdest].valid = false
+		if pdest > computer.highWater {
+			computer.highWater = pdest
+		}
+		computer.ip += 4
+	case 5, 6:
+		p1, ok1 := fastValue(computer, ParamMode(d.modes[1]), ip+1)
+		p2, ok2 := fastValue(computer, ParamMode(d.modes[2]), ip+2)
+		if !ok1 || !ok2 {
+			return false
+		}
+		if (p1 != 0) == (d.opcode == 5) {
+			computer.ip = p2
+		} else {
+			computer.ip += 3
+		}
+	case 9:
+		p1, ok := fastValue(computer, ParamMode(d.modes[1]), ip+1)
+		if !ok {
+			return false
+		}
+		computer.relativeBase += p1
+		computer.ip += 2
+	default:
+		return false
 	}
-	log.Fatal("Unknown parameter mode ", mode)
-	return 0
+	computer.steps++
+	return true
 }
@@ -0,0 +1,131 @@
+// Input sources and output sinks for the ship computer.
+//
+// Attach one with attachInput or attachOutput to wire a program to a slice,
+// a channel, a reader/writer or a plain function.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Feeds values from a slice, oldest first
+type SliceInput struct {
+	values []int
+}
+
+func newSliceInput(values ...int) *SliceInput {
+	return &SliceInput{values: values}
+}
+
+func (in *SliceInput) Read() (int, bool) {
+	if len(in.values) == 0 {
+		return 0, false
+	}
+	value := in.values[0]
+	in.values = in.values[1:]
+	return value, true
+}
+
+// Collects outputs in a slice
+type SliceOutput struct {
+	values []int
+}
+
+func (out *SliceOutput) Write(value int) {
+	out.values = append(out.values, value)
+}
+
+// Feeds values received from a channel; blocks until one arrives or the channel is closed
+type ChanInput <-chan int
+
+func (in ChanInput) Read() (int, bool) {
+	value, ok := <-in
+	return value, ok
+}
+
+// Sends outputs on a channel
+type ChanOutput chan<- int
+
+func (out ChanOutput) Write(value int) {
+	out <- value
+}
+
+// Feeds integers parsed from a reader. Values may be separated by whitespace or commas.
+// Reading stops at end of input or at the first token that isn't an integer; err records why.
+type ReaderInput struct {
+	scanner *bufio.Scanner
+	err     error
+}
+
+func newReaderInput(r io.Reader) *ReaderInput {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanIntTokens)
+	return &ReaderInput{scanner: scanner}
+}
+
+func (in *ReaderInput) Read() (int, bool) {
+	if in.err != nil || !in.scanner.Scan() {
+		if in.err == nil {
+			in.err = in.scanner.Err()
+		}
+		return 0, false
+	}
+	value, err := strconv.Atoi(in.scanner.Text())
+	if err != nil {
+		in.err = err
+		return 0, false
+	}
+	return value, true
+}
+
+// Split function for bufio.Scanner: tokens are separated by whitespace or commas
+func scanIntTokens(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	isSep := func(b byte) bool {
+		return b == ',' || b == ' ' || b == '\t' || b == '\n' || b == '\r'
+	}
+
+	start := 0
+	for start < len(data) && isSep(data[start]) {
+		start++
+	}
+	for end := start; end < len(data); end++ {
+		if isSep(data[end]) {
+			return end + 1, data[start:end], nil
+		}
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil
+}
+
+// Writes each output to a writer on its own line
+type WriterOutput struct {
+	w io.Writer
+}
+
+func newWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{w: w}
+}
+
+func (out *WriterOutput) Write(value int) {
+	fmt.Fprintln(out.w, value)
+}
+
+// Adapts a function to an InputSource
+type InputFunc func() (int, bool)
+
+func (f InputFunc) Read() (int, bool) {
+	return f()
+}
+
+// Adapts a function to an OutputSink
+type OutputFunc func(int)
+
+func (f OutputFunc) Write(value int) {
+	f(value)
+}
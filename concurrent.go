@@ -0,0 +1,104 @@
+// Running ship computers concurrently, one goroutine per computer, connected by channels.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// A computer wired up for runConcurrently. Queued inputs on the computer are read before in.
+// Either channel may be nil: a nil in means the computer only has its queued inputs, and with
+// a nil out, outputs are collected on the computer as usual.
+// Each out channel must be written by one machine only, since it is closed when that machine stops.
+type Machine struct {
+	computer *IntComputer
+	in       <-chan int
+	out      chan<- int
+}
+
+// Reads from a channel, giving up when done is closed
+type cancellableInput struct {
+	in   <-chan int
+	done <-chan struct{}
+}
+
+func (c cancellableInput) Read() (int, bool) {
+	select {
+	case value, ok := <-c.in:
+		return value, ok
+	case <-c.done:
+		return 0, false
+	}
+}
+
+// Run every machine on its own goroutine and wait for all of them to stop.
+//
+// A machine stops when it halts, when it fails, or when it needs input and its input channel
+// is closed. Its output channel is then closed, so machines reading from it stop in turn.
+// If a machine fails, the others are cancelled and the first error is returned.
+func runConcurrently(machines ...Machine) error {
+	return runConcurrentlyContext(context.Background(), machines...)
+}
+
+// Like runConcurrently, but every machine also stops with ErrBudgetExceeded once ctx is done
+func runConcurrentlyContext(ctx context.Context, machines ...Machine) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for id, machine := range machines {
+		wg.Add(1)
+		go func(id int, machine Machine) {
+			defer wg.Done()
+			if machine.out != nil {
+				defer close(machine.out)
+			}
+			computer := machine.computer
+			if machine.in != nil {
+				attachInput(computer, cancellableInput{machine.in, ctx.Done()})
+			}
+
+			for {
+				reason, err := resumeContext(ctx, computer, Budget{})
+				if err != nil {
+					fail(fmt.Errorf("machine %d: %w", id, err))
+					return
+				}
+				switch reason {
+				case Halted:
+					return
+				case NeedsInput:
+					if ctx.Err() != nil {
+						// Input was cut off by the cancellation, not by the channel closing
+						fail(fmt.Errorf("machine %d: %w", id, computerError(ErrBudgetExceeded, computer, ctx.Err().Error())))
+					}
+					return
+				case Output:
+					if machine.out == nil {
+						continue
+					}
+					value, _ := popOutput(computer)
+					select {
+					case machine.out <- value:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}(id, machine)
+	}
+
+	wg.Wait()
+	return firstErr
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -22,59 +25,113 @@ func prelimTests() {
 			log.Fatal("Expected " + test.output + " got " + runPart1(test.input, false, 0, 0))
 		}
 	}
+	// Patching a program too short to hold the noun and verb grows its memory
+	if state, err := runProgram("99", true, 12, 2); err != nil || state != "99,12,2" {
+		log.Fatalf("Expected the patched short program to be 99,12,2, got %s (%v)", state, err)
+	}
+	selfModificationTests()
+	symbolicTests()
+	// Solving and searching must agree: ADD #noun, #verb, [13]; MUL [1], #100, [0]; ADD [0], [2], [0]; HALT
+	nounVerb := "1101,0,0,13,1002,1,100,0,1,0,2,0,99,0"
+	if noun, verb, err := solveNounVerb(nounVerb, 1234); err != nil || noun != 12 || verb != 34 {
+		log.Fatalf("Expected to solve for noun=12, verb=34, got %d, %d (%v)", noun, verb, err)
+	}
+	if noun, verb := searchNounVerb(nounVerb, 1234); noun != 12 || verb != 34 {
+		log.Fatalf("Expected to find noun=12, verb=34, got %d, %d", noun, verb)
+	}
 	log.Println("Day 2 prelim tests passed.")
 }
 
-func makeComputer(inst []string) []int {
-	var comp []int = make([]int, len(inst))
-	for id, item := range inst {
-		opcode, err := strconv.Atoi(item)
-		if err != nil {
-			log.Fatal("Can't convert instruction to int")
+func selfModificationTests() {
+	// The add at 0 writes over the 99 at 4, which then runs as a multiply writing over the add
+	computer, _ := initComputer("1,1,1,4,99,5,6,0,99", nil)
+	watchSelfModification(computer, false)
+	if err := runContext(context.Background(), computer, Budget{maxSteps: stepBudget}); err != nil {
+		log.Fatal(err)
+	}
+	expected := []SelfModReport{{WriterIP: 0, Addr: 4, Later: true, Count: 1}, {WriterIP: 4, Addr: 0, Later: false, Count: 1}}
+	if reports := selfModifications(computer); fmt.Sprint(reports) != fmt.Sprint(expected) {
+		log.Fatalf("Expected self-modification reports %v, got %v", expected, reports)
+	}
+
+	// Strict mode refuses to run the overwritten 99, and to overwrite code that already ran
+	for _, test := range []struct{ program, state string }{
+		{"1,1,1,4,99,5,6,0,99", "1,1,1,4,2,5,6,0,99"},
+		{"1,0,0,0,99", "1,0,0,0,99"}} {
+		computer, _ := initComputer(test.program, nil)
+		watchSelfModification(computer, true)
+		err := runContext(context.Background(), computer, Budget{maxSteps: stepBudget})
+		if _, state := snapshotComputer(computer); !errors.Is(err, ErrSelfModifyingCode) || state != test.state {
+			log.Fatalf("Expected %s to be refused, leaving %s, got %s (%v)", test.program, test.state, state, err)
 		}
-		comp[id] = opcode
 	}
-	return comp
 }
 
-func snapshotComputer(comp []int) []string {
-	var result []string = make([]string, len(comp))
-	for id, item := range comp {
-		result[id] = strconv.Itoa(item)
+func symbolicTests() {
+	// The example program computes ([9] + [10]) * [11] into [0]
+	computer, _ := initSymComputer("1,9,10,3,2,3,11,0,99,30,40,50")
+	symbolizeCell(computer, 9, "a", 0, 100)
+	paths, err := explore(computer, stepBudget, 1)
+	if err != nil || len(paths) != 1 || symCell(paths[0], 0).String() != "(a + 40)*50" {
+		log.Fatalf("Expected one path leaving (a + 40)*50 in [0], got %d paths (%v)", len(paths), err)
+	}
+	if solution, ok, err := solveMemory(computer, paths, 0, 3500); err != nil || !ok || solution["a"] != 30 {
+		log.Fatalf("Expected a=30, got %v (%v)", solution, err)
+	}
+	if _, ok, err := solveMemory(computer, paths, 0, 3501); err != nil || ok {
+		log.Fatalf("Expected no solution for 3501, got %v", err)
+	}
+
+	// Outputs 0 if the input is 0, and 1 otherwise: the jump on the input forks two paths
+	computer, _ = initSymComputer("3,3,1105,-1,9,1101,0,0,12,4,12,99,1")
+	addSymbolicInput(computer, "x", -5, 5)
+	paths, err = explore(computer, stepBudget, 2)
+	if err != nil || len(paths) != 2 {
+		log.Fatalf("Expected 2 paths, got %d (%v)", len(paths), err)
+	}
+	for _, test := range []struct{ output, x int }{{1, -5}, {0, 0}} {
+		if solution, ok, err := solveOutput(computer, paths, 0, test.output); err != nil || !ok || solution["x"] != test.x {
+			log.Fatalf("Expected output %d for x=%d, got %v (%v)", test.output, test.x, solution, err)
+		}
+	}
+
+	// Writing through a symbolic address can't be followed
+	computer, _ = initSymComputer("1,0,0,0,99")
+	symbolizeCell(computer, 3, "addr", 0, 4)
+	if _, err := explore(computer, stepBudget, 1); !errors.Is(err, ErrSymbolicAddress) {
+		log.Fatalf("Expected a symbolic address error, got %v", err)
 	}
-	return result
 }
 
+// Most instructions one noun/verb pair may run before it is skipped as a runaway
+const stepBudget = 100000
+
 func runPart1(input string, fix bool, noun int, verb int) string {
-	instructions := strings.Split(input, ",")
-	computer := makeComputer(instructions)
-	if fix {
-		computer[1] = noun
-		computer[2] = verb
+	state, err := runProgram(input, fix, noun, verb)
+	if err != nil {
+		log.Fatal(err)
 	}
-	process(computer, 0)
-	snapshot := snapshotComputer(computer)
-	return strings.Join(snapshot, ",")
+	return state
 }
 
-func process(computer []int, pc int) {
-	op := computer[pc]
-	if op == 99 {
-		return
+// Run the program, with noun and verb patched in if fix is set, and return its final memory
+func runProgram(input string, fix bool, noun int, verb int) (string, error) {
+	computer, err := initComputer(input, nil)
+	if err != nil {
+		return "", err
 	}
-	psrc1 := computer[pc+1]
-	psrc2 := computer[pc+2]
-	pdest := computer[pc+3]
-
-	if op == 1 {
-		computer[pdest] = computer[psrc1] + computer[psrc2]
-	} else if op == 2 {
-		computer[pdest] = computer[psrc1] * computer[psrc2]
-	} else {
-		log.Fatal("Unexpected opcode!")
+	if fix {
+		store(computer, 1, noun)
+		store(computer, 2, verb)
 	}
-
-	process(computer, pc+4)
+	if err := runContext(context.Background(), computer, Budget{maxSteps: stepBudget}); err != nil {
+		return "", err
+	}
+	if !computer.terminated {
+		return "", computerError(ErrNoInput, computer, "")
+	}
+	_, state := snapshotComputer(computer)
+	return state, nil
 }
 
 func part1() {
@@ -86,20 +143,45 @@ func part1() {
 
 func part2() {
 	input := getData(2)
-	initialState := input[:]
-
-	var noun, verb int
-	for noun = 0; noun < 100; noun++ {
-		for verb = 0; verb < 100; verb++ {
-			result := runPart1(input[0], true, noun, verb)
-			state := strings.Split(result, ",")
-			if state[0] == "19690720" {
-				log.Printf("Day 2, part 2 solution: noun=%d, verb=%d\n", noun, verb)
-				break
-			}
-			input = initialState[:]
-		}
+	noun, verb, err := solveNounVerb(input[0], 19690720)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Day 2, part 2 solution: noun=%d, verb=%d\n", noun, verb)
+}
+
+// Find the noun and verb that leave target in address 0 by solving the program symbolically
+func solveNounVerb(program string, target int) (int, int, error) {
+	computer, err := initSymComputer(program)
+	if err != nil {
+		return 0, 0, err
+	}
+	symbolizeCell(computer, 1, "noun", 0, 99)
+	symbolizeCell(computer, 2, "verb", 0, 99)
+	paths, err := explore(computer, stepBudget, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	solution, ok, err := solveMemory(computer, paths, 0, target)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return 0, 0, fmt.Errorf("no noun and verb give %d", target)
+	}
+	return solution["noun"], solution["verb"], nil
+}
+
+// Run the program with every noun and verb until it leaves target in address 0
+func searchNounVerb(program string, target int) (int, int) {
+	found, ok, err := sweepFirst(product(valueRange(0, 99), valueRange(0, 99)), 0, scores(patchedRun(program, []int{1, 2}, 0, stepBudget), target))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !ok {
+		return -1, -1
 	}
+	return found[0], found[1]
 }
 
 func main() {
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
 )
 
 const day int = 5
@@ -45,6 +50,10 @@ func prelimTests() {
 		Test{"3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99", 9, "", 1001}}
 	for id, test := range tests {
 		output, terminationState := runPart1(test.begState, test.input)
+		if o, st := runDiagnostic(test.begState, test.input, true); o != output || st != terminationState {
+			log.Printf("Predecoded run gave %d, %s; interpreter gave %d, %s", o, st, output, terminationState)
+			log.Fatal("Failed test #" + strconv.Itoa(id))
+		}
 		if test.endState == "" {
 			// We don't care about state, only output value
 			if output != test.output {
@@ -58,12 +67,376 @@ func prelimTests() {
 			}
 		}
 	}
+	asmTests()
+	customOpcodeTests()
+	reverseTests()
+	cfgTests()
+	debuggerTests()
+	traceTests()
+	profilerTests()
+	executedTests()
 	log.Println("Day 5 prelim tests passed.")
 }
 
+// The comparison examples above, written in assembly. Each must assemble to the
+// hand-encoded program and survive a trip through the disassembler.
+func asmTests() {
+	type AsmTest struct {
+		source  string
+		program string
+	}
+
+	tests := [...]AsmTest{
+		AsmTest{`
+			IN  [x]
+			EQ  [x], [eight], [x]   ; x = (x == 8)
+			OUT [x]
+			HALT
+		x:      DATA -1
+		eight:  DATA 8`, "3,9,8,9,10,9,4,9,99,-1,8"},
+		AsmTest{`
+			IN	[x]
+			LT	[x], #8, [x]        ; x = (x < 8)
+			OUT [x]
+			HALT
+		x:      DATA -1`, "3,9,1007,9,8,9,4,9,99,-1"},
+		AsmTest{`
+			IN  [x + 1]             ; patches the first operand of the LT below
+		x:      LT  #-1, #8, [x + 1]
+			OUT [x + 1]
+			HALT`, "3,3,1107,-1,8,3,4,3,99"},
+		AsmTest{`
+			IN  [x]
+			JF  [x], [target]       ; skip the increment when x is zero
+			ADD [acc], [one], [acc]
+		zero:   OUT [acc]
+			HALT
+		x:      DATA -1
+		acc:    DATA 0
+		one:    DATA 1
+		target: DATA zero`, "3,12,6,12,15,1,13,14,13,4,13,99,-1,0,1,9"},
+	}
+	for id, test := range tests {
+		program, err := assemble(test.source)
+		if err != nil {
+			log.Fatal("Failed assembler test #"+strconv.Itoa(id)+": ", err)
+		}
+		if program != test.program {
+			log.Printf("Expected program %s, got %s", test.program, program)
+			log.Fatal("Failed assembler test #" + strconv.Itoa(id))
+		}
+
+		computer, err := initComputer(program, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		words := computer.state[:computer.highWater+1]
+		roundTrip, err := assemble(listingSource(disassemble(words, nil)))
+		if err != nil || roundTrip != program {
+			log.Printf("Expected round trip %s, got %s (%v)", program, roundTrip, err)
+			log.Fatal("Failed assembler test #" + strconv.Itoa(id))
+		}
+	}
+
+	// Errors point at the source line
+	_, err := assemble("\tIN [x]\n\tOUT [y]\nx: DATA 0")
+	if asmErr, ok := err.(*AsmError); !ok || asmErr.Line != 2 {
+		log.Fatalf("Expected an error on line 2, got %v", err)
+	}
+}
+
+// An experimental SUB instruction, opcode 10, registered on one computer only
+func customOpcodeTests() {
+	sub := instructionInfo{"SUB", 3, 3, func(pm [4]ParamMode, computer *IntComputer) error {
+		p1, p2, pdest, err := getParams3(pm, computer)
+		if err != nil {
+			return err
+		}
+		store(computer, pdest, p1-p2)
+		computer.ip += 4
+		return nil
+	}}
+	program := "3,9,1010,9,5,9,4,9,99,0" // IN [9]; SUB [9], #5, [9]; OUT [9]; HALT
+
+	computer, _ := initComputer(program, []int{12})
+	if err := registerOpcode(computer, 10, sub); err != nil {
+		log.Fatal(err)
+	}
+	if err := registerOpcode(computer, 1, sub); err == nil {
+		log.Fatal("Expected an error registering over a built-in opcode")
+	}
+	if line, ok := decodeInstructionFor(computer, computer.state, 2); !ok || line.mnemonic != "SUB" {
+		log.Fatalf("Expected SUB at address 2, got %s", line)
+	}
+	if err := run(computer); err != nil || !computer.terminated || computer.outputs[0] != 7 {
+		log.Fatalf("Expected SUB program to output 7, got %v (%v)", computer.outputs, err)
+	}
+
+	// Other computers don't know the opcode
+	other, _ := initComputer(program, []int{12})
+	if err := run(other); !errors.Is(err, ErrUnknownOpcode) {
+		log.Fatalf("Expected an unknown opcode error, got %v", err)
+	}
+}
+
+// Control-flow graphs: blocks, edge labels, and jumps through cells the program writes
+func cfgTests() {
+	type CFGTest struct {
+		program []int
+		blocks  string // start-end, successors and flags of each block
+	}
+
+	tests := [...]CFGTest{
+		// JT #1, [7] jumps to the 4 in cell 7
+		CFGTest{[]int{105, 1, 7, 99, 104, 42, 99, 4}, "0-3 [4 always] 4-7 []"},
+		// Straight-line code that runs off the end of the program
+		CFGTest{[]int{1101, 1, 1, 5}, "0-4 [] invalid"},
+		// The target in cell 15 isn't written, so JF [12], [15] gets both edges
+		CFGTest{[]int{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9}, "0-5 [9 [12] == 0, 5 [12] != 0] 5-9 [9] 9-12 []"},
+		// The target in cell 6 is written by IN, so the jump is indirect
+		CFGTest{[]int{3, 6, 105, 1, 6, 99, 5}, "0-5 [] indirect"},
+	}
+	for id, test := range tests {
+		cfg := buildCFG(test.program)
+		var blocks []string
+		for _, start := range cfg.starts() {
+			block := cfg.blocks[start]
+			var succs []string
+			for _, succ := range block.succs {
+				succs = append(succs, strings.TrimSpace(fmt.Sprintf("%d %s", succ.to, succ.label)))
+			}
+			desc := fmt.Sprintf("%d-%d [%s]", block.start, block.end, strings.Join(succs, ", "))
+			if block.indirect {
+				desc += " indirect"
+			}
+			if block.invalid {
+				desc += " invalid"
+			}
+			blocks = append(blocks, desc)
+		}
+		if got := strings.Join(blocks, " "); got != test.blocks {
+			log.Printf("Expected blocks %s, got %s", test.blocks, got)
+			log.Fatal("Failed CFG test #" + strconv.Itoa(id))
+		}
+		// Every edge in the DOT output must lead to a block
+		var dot strings.Builder
+		cfg.writeDOT(&dot)
+		for _, start := range cfg.starts() {
+			for _, succ := range cfg.blocks[start].succs {
+				if !strings.Contains(dot.String(), fmt.Sprintf("\tb%d [", succ.to)) {
+					log.Fatalf("CFG test #%d: edge to missing block b%d in\n%s", id, succ.to, dot.String())
+				}
+			}
+		}
+	}
+}
+
+// A JSON trace has one line per instruction, recording what it read, wrote, consumed and produced
+func traceTests() {
+	computer, _ := initComputer("3,0,4,0,99", []int{42}) // IN [0]; OUT [0]; HALT
+	var out bytes.Buffer
+	tracer := newJSONTracer(&out)
+	attachTracer(computer, tracer)
+	if err := run(computer); err != nil || tracer.err != nil {
+		log.Fatalf("Expected a clean traced run, got %v, %v", err, tracer.err)
+	}
+	expected := []string{
+		"step 1 ip 0 opcode 3 IN writes [{0 3 42}] input 42 output -",
+		"step 2 ip 2 opcode 4 OUT writes [] input - output 42",
+		"step 3 ip 4 opcode 99 HALT writes [] input - output -",
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		log.Fatalf("Expected %d trace lines, got %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		var record TraceRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			log.Fatalf("Expected trace line %d to be JSON, got %q (%v)", i, line, err)
+		}
+		input, output := "-", "-"
+		if record.Input != nil {
+			input = strconv.Itoa(*record.Input)
+		}
+		if record.Output != nil {
+			output = strconv.Itoa(*record.Output)
+		}
+		got := fmt.Sprintf("step %d ip %d opcode %d %s writes %v input %s output %s", record.Step, record.IP, record.Opcode, record.Mnemonic, record.Writes, input, output)
+		if got != expected[i] {
+			log.Fatalf("Expected trace line %d to be %q, got %q from %s", i, expected[i], got, line)
+		}
+	}
+}
+
+// Profile a countdown from 3, whose JT back to the decrement is taken twice
+func profilerTests() {
+	// ADD #0, #3, [20]; loop: ADD [20], #-1, [20]; JT [20], #loop; HALT
+	computer, _ := initComputer("1101,0,3,20,1001,20,-1,20,1005,20,4,99", nil)
+	program := append([]int(nil), computer.state...)
+	profiler := newProfiler()
+	attachTracer(computer, profiler)
+	if err := run(computer); err != nil {
+		log.Fatal(err)
+	}
+	counts := fmt.Sprint(profiler.instructions, profiler.byAddr, profiler.reads, profiler.writes, profiler.backEdges)
+	if expected := "8 map[0:1 4:3 8:3 11:1] map[20:6] map[20:4] map[{8 4}:2]"; counts != expected {
+		log.Fatalf("Expected profile %s, got %s", expected, counts)
+	}
+
+	var listing bytes.Buffer
+	if err := profiler.writeAnnotatedListing(&listing, program); err != nil {
+		log.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(listing.String(), "\n"), "\n")
+	if halt := strings.Fields(lines[len(lines)-1]); fmt.Sprint(halt) != "[1 11 HALT]" {
+		log.Fatalf("Expected the HALT listed as executed once, got %q", listing.String())
+	}
+}
+
+// traceExecution finds the instructions a run reaches, and gives up on one that never halts
+func executedTests() {
+	computer, _ := initComputer("3,9,8,9,10,9,4,9,99,-1,8", []int{8}) // IN [9]; EQ [9], [10], [9]; OUT [9]; HALT
+	executed, err := traceExecution(computer, Budget{maxSteps: 100})
+	if err != nil || fmt.Sprint(executed) != "map[0:true 2:true 6:true 8:true]" {
+		log.Fatalf("Expected instructions at 0, 2, 6 and 8, got %v (%v)", executed, err)
+	}
+	if lines := disassemble(computer.state, executed); len(lines) != 6 || lines[4].mnemonic != "DATA" {
+		log.Fatalf("Expected the cells after HALT listed as DATA, got %v", lines)
+	}
+
+	spinning, _ := initComputer("1105,1,0", nil)
+	executed, err = traceExecution(spinning, Budget{maxSteps: 100})
+	if !errors.Is(err, ErrBudgetExceeded) || fmt.Sprint(executed) != "map[0:true]" {
+		log.Fatalf("Expected a self-jump to exceed its budget after running 0, got %v (%v)", executed, err)
+	}
+}
+
+// A debugger session, each command checked against what it prints
+func debuggerTests() {
+	computer, _ := initComputer("3,9,8,9,10,9,4,9,99,-1,8", nil) // IN [9]; EQ [9], [10], [9]; OUT [9]; HALT
+	var out bytes.Buffer
+	d := newDebugger(computer, &out)
+	session := []struct{ command, output string }{
+		{"c", "waiting for input; queue some with: in <values>\n=> 0: IN [9]\n"},
+		{"in 8", ""},
+		{"w 9", ""},
+		{"c", "watchpoint [9]: -1 -> 8\n=> 2: EQ [9], [10], [9]\n"},
+		{"d 9", ""},
+		{"c", "output: 1\nprogram halted\n"},
+		{"rs 2", "=> 2: EQ [9], [10], [9]\n"},
+		{"r", "ip=2 rb=0 steps=1 terminated=false history=1\ninputs=[] outputs=[]\n"},
+		{"c", "output: 1\nprogram halted\n"},
+		// Moving the instruction pointer restarts a halted program
+		{"ip 0", "history cleared\n=> 0: IN [9]\n"},
+		{"in 7", ""},
+		{"c", "output: 0\nprogram halted\n"},
+		{"rw 9", "=> 2: EQ [9], [10], [9]\n"},
+		{"x 9", "[9] = 7\n"},
+		{"ro 0", "error: not in recorded history at ip=2 (opcode 8, relative base 0): no recorded output #0\n"},
+	}
+	for _, step := range session {
+		out.Reset()
+		if d.execute(step.command) || out.String() != step.output {
+			log.Fatalf("Expected %q to print %q, got %q", step.command, step.output, out.String())
+		}
+	}
+	if !d.execute("q") {
+		log.Fatal("Expected q to quit")
+	}
+}
+
+// Stepping back through a run must retrace it exactly, cache included
+func reverseTests() {
+	program := "3,9,8,9,10,9,4,9,99,-1,8" // IN [9]; EQ [9], [10], [9]; OUT [9]; HALT
+	computer, _ := initComputer(program, []int{8})
+	enablePredecode(computer)
+	recordHistory(computer, 0)
+	if err := run(computer); err != nil || computer.outputs[0] != 1 {
+		log.Fatalf("Expected output 1, got %v (%v)", computer.outputs, err)
+	}
+	if err := backToOutput(computer, 0); err != nil || computer.ip != 6 || len(computer.outputs) != 0 {
+		log.Fatalf("Expected to be back at the OUT at 6 with no outputs, got ip=%d %v (%v)", computer.ip, computer.outputs, err)
+	}
+	if err := backToWrite(computer, 9); err != nil || computer.ip != 2 || computer.state[9] != 8 {
+		log.Fatalf("Expected to be back at the EQ at 2 with [9]=8, got ip=%d [9]=%d (%v)", computer.ip, computer.state[9], err)
+	}
+	if err := stepBack(computer); err != nil || computer.ip != 0 || computer.steps != 0 || len(computer.inputs) != 1 {
+		log.Fatalf("Expected to be back at the start with the input queued, got ip=%d inputs=%v (%v)", computer.ip, computer.inputs, err)
+	}
+	if _, state := snapshotComputer(computer); state != program {
+		log.Fatalf("Expected the original program after undoing everything, got %s", state)
+	}
+	if err := stepBack(computer); !errors.Is(err, ErrNoHistory) {
+		log.Fatalf("Expected a no history error, got %v", err)
+	}
+	if err := run(computer); err != nil || computer.outputs[0] != 1 || historyLen(computer) != 3 {
+		log.Fatalf("Expected the rerun to output 1 in 3 instructions, got %v (%v)", computer.outputs, err)
+	}
+
+	// ADD #2, #2, [11]; OUT [11]; OUT #0; HALT: the first test fails with 4, computed at 0
+	failure, err := findDiagnosticFailure("1101,2,2,11,4,11,104,0,99,0,0,0", 0)
+	if err != nil || failure == nil || *failure != (diagnosticFailure{0, 4, 4, 0}) {
+		log.Fatalf("Expected test 0 to fail with 4 output at 4 and written at 0, got %+v (%v)", failure, err)
+	}
+}
+
+// Where a diagnostic test went wrong
+type diagnosticFailure struct {
+	test, value int // which output, and its value
+	outputIP    int // the instruction that output it
+	writerIP    int // the instruction that wrote the value output, or -1 if it wasn't read from memory
+}
+
+// Run a diagnostic program, and trace the first test that failed (output something other than 0,
+// before the final diagnostic code) back to where its value was computed. Returns nil if all passed.
+func findDiagnosticFailure(begState string, input int) (*diagnosticFailure, error) {
+	computer, err := initComputer(begState, []int{input})
+	if err != nil {
+		return nil, err
+	}
+	recordHistory(computer, 0)
+	if err := runToHalt(computer); err != nil {
+		return nil, err
+	}
+	for n := 0; n < len(computer.outputs)-1; n++ {
+		value := computer.outputs[n]
+		if value == 0 {
+			continue
+		}
+		if err := backToOutput(computer, n); err != nil {
+			return nil, err
+		}
+		failure := &diagnosticFailure{n, value, computer.ip, -1}
+		_, modes := decodeOp(computer.state[computer.ip])
+		if modes[1] != DIRECT {
+			addr, err := getParamAddr(modes[1], computer.ip+1, computer)
+			if err != nil {
+				return nil, err
+			}
+			if backToWrite(computer, addr) == nil {
+				failure.writerIP = computer.ip
+			}
+		}
+		return failure, nil
+	}
+	return nil, nil
+}
+
 func runPart1(begState string, input int) (output int, endState string) {
-	computer := initComputer(begState, []int{input})
-	computer = run(computer)
+	return runDiagnostic(begState, input, false)
+}
+
+func runDiagnostic(begState string, input int, predecode bool) (output int, endState string) {
+	computer, err := initComputer(begState, []int{input})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if predecode {
+		enablePredecode(computer)
+	}
+	if err := runToHalt(computer); err != nil {
+		log.Fatal(err)
+	}
 	output, endState = snapshotComputer(computer)
 	return
 }
@@ -71,6 +444,11 @@ func runPart1(begState string, input int) (output int, endState string) {
 func part1() {
 	data := getData(day)
 	out, _ := runPart1(data[0], 1) // 1 is input from Day 5, Part 1
+	if failure, err := findDiagnosticFailure(data[0], 1); err != nil {
+		log.Fatal(err)
+	} else if failure != nil {
+		log.Printf("Diagnostic test %d failed with %d: output at %d, computed at %d", failure.test, failure.value, failure.outputIP, failure.writerIP)
+	}
 	log.Printf("Day 5, Part 1 output: %d", out)
 }
 
@@ -1,9 +1,13 @@
 package main
 
 import (
-	prmt "github.com/gitchander/permutation"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Test struct {
@@ -14,11 +18,139 @@ type Test struct {
 
 const day int = 7
 
+// Most instructions one amp may run for a setting before the setting is skipped as a runaway
+const ampStepBudget = 1000000
+
 func prelimTests() {
+	sweepTests()
+	networkTests()
+	concurrentTests()
 	part1PrelimTests()
 	part2PrelimTests()
 }
 
+// Three nodes on a network. At boot, each sends its address and 7 to the next address up;
+// after that it forwards each packet it receives to address 255, and spins reading -1 while
+// it has none. Address 3 has no machine.
+func networkTests() {
+	// IN [addr]; ADD [addr], #1, [dest]; OUT [dest]; OUT [addr]; OUT #7
+	// loop: IN [x]; EQ [x], #-1, [t]; JT [t], #loop; IN [y]; OUT #255; OUT [x]; OUT [y]; JT #1, #loop
+	node := "3,32,1001,32,1,33,4,33,4,32,104,7,3,34,1008,34,-1,36,1005,36,12,3,35,104,255,4,34,4,35,1105,1,12,0,0,0,0,0"
+	const x = 34
+
+	network, err := newNetwork(node, 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var forwarded []Packet
+	network.intercept(255, func(network *Network, packet Packet) bool {
+		forwarded = append(forwarded, packet)
+		if len(forwarded) == 2 {
+			network.stop()
+		}
+		return false // swallowed: 255 has no machine, but nothing is dropped
+	})
+	// Packets are delivered in the round they are sent, so nodes 1 and 2 forward theirs at once
+	if stopped, err := network.run(10); err != nil || !stopped || network.rounds != 1 {
+		log.Fatalf("Expected the hook to stop the network after 1 round, got %d rounds (%v)", network.rounds, err)
+	}
+	if fmt.Sprint(forwarded) != "[{1 255 0 7 false} {2 255 1 7 false}]" || fmt.Sprint(network.dropped) != "[{2 3 2 7 false}]" {
+		log.Fatalf("Expected 2 packets forwarded and 1 dropped, got %v and %v", forwarded, network.dropped)
+	}
+	if network.machines[0].state[x] != -1 || network.machines[1].state[x] != 0 {
+		log.Fatalf("Expected node 0 to read -1 and node 1 to read the packet from 0, got %d and %d", network.machines[0].state[x], network.machines[1].state[x])
+	}
+	// With nothing queued, every node reads -1 and nothing more is sent
+	if _, err := network.run(1); err != nil || len(forwarded) != 2 || !network.quiet() {
+		log.Fatalf("Expected a quiet round, got %v (%v)", forwarded, err)
+	}
+	for addr, computer := range network.machines {
+		if computer.state[x] != -1 {
+			log.Fatalf("Expected node %d to read -1, got %d", addr, computer.state[x])
+		}
+	}
+
+	// Packets cut short by a halt or a failure are dropped as partial
+	for _, test := range []struct {
+		node    string
+		failed  bool
+		dropped string
+	}{{"104,5,104,6,99", false, "[{0 5 6 0 true}]"}, {"104,5,98", true, "[{0 5 0 0 true}]"}} {
+		network, _ := newNetwork(test.node, 1)
+		_, err := network.run(1)
+		if (err != nil) != test.failed || fmt.Sprint(network.dropped) != test.dropped {
+			log.Fatalf("Expected %s to drop %s, got %v (%v)", test.node, test.dropped, network.dropped, err)
+		}
+	}
+
+	// A node that never waits for input fails its round instead of hanging the network
+	network, _ = newNetwork("3,0,1105,1,2", 2)
+	network.turnSteps = 1000
+	if _, err := network.run(1); !errors.Is(err, ErrBudgetExceeded) {
+		log.Fatalf("Expected a spinning node to exceed its budget, got %v", err)
+	}
+}
+
+// A machine hitting an unknown opcode fails the whole run, and cancels the others:
+// one spinning in a tight loop and one waiting on input that never comes
+func concurrentTests() {
+	spinning, _ := initComputer("1105,1,0", nil)
+	broken, _ := initComputer("98,0,0,99", nil)
+	waiting, _ := initComputer("3,0,4,0,99", nil)
+	spinOut, waitOut := make(chan int), make(chan int)
+	done := make(chan error)
+	go func() {
+		done <- runConcurrently(
+			Machine{computer: spinning, out: spinOut},
+			Machine{computer: broken},
+			Machine{computer: waiting, in: make(chan int), out: waitOut})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrUnknownOpcode) || !strings.HasPrefix(err.Error(), "machine 1: ") {
+			log.Fatalf("Expected machine 1's unknown opcode error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		log.Fatal("Expected the other machines to stop after machine 1 failed")
+	}
+	if _, open := <-spinOut; open || spinning.terminated {
+		log.Fatal("Expected the spinning machine to be cancelled and its output closed")
+	}
+	if _, open := <-waitOut; open || waiting.terminated {
+		log.Fatal("Expected the waiting machine to be cancelled and its output closed")
+	}
+}
+
+// Spaces come out in a fixed order, and so do sweep results, however many workers run them
+func sweepTests() {
+	perms := permutationsOf(1, 2, 3)
+	var all [][]int
+	for i := 0; i < perms.Size(); i++ {
+		all = append(all, perms.At(i))
+	}
+	if fmt.Sprint(all) != "[[1 2 3] [1 3 2] [2 1 3] [2 3 1] [3 1 2] [3 2 1]]" {
+		log.Fatalf("Expected permutations in lexicographic order, got %v", all)
+	}
+	space := product(valueRange(0, 1), permutationsOf(5, 6))
+	if space.Size() != 4 || fmt.Sprint(space.At(1), space.At(2)) != "[0 6 5] [1 5 6]" {
+		log.Fatalf("Expected 4 candidates with the last space varying fastest, got %d: %v %v", space.Size(), space.At(1), space.At(2))
+	}
+
+	multipleOf7 := func(candidate []int) (bool, error) { return candidate[0]%7 == 0, nil }
+	matches, err := sweepMatches(valueRange(1, 50), 4, multipleOf7)
+	if err != nil || fmt.Sprint(matches) != "[[7] [14] [21] [28] [35] [42] [49]]" {
+		log.Fatalf("Expected multiples of 7 in order, got %v (%v)", matches, err)
+	}
+	equals8 := "3,9,8,9,10,9,4,9,99,-1,8"
+	if first, ok, err := sweepFirst(valueRange(0, 20), 4, scores(inputRun(equals8, 100), 1)); err != nil || !ok || first[0] != 8 {
+		log.Fatalf("Expected input 8 to be the first to output 1, got %v (%v)", first, err)
+	}
+	if best, ok, err := sweepBest(valueRange(3, 9), 4, func([]int) (int, error) { return 0, nil }); err != nil || !ok || best.candidate[0] != 3 {
+		log.Fatalf("Expected a tie to go to the first candidate, got %v (%v)", best, err)
+	}
+}
+
 func part1PrelimTests() {
 	tests := [...]Test{
 		Test{"3,15,3,16,1002,16,10,16,1,16,15,15,4,15,99,0,0", "43210", 43210},
@@ -32,6 +164,14 @@ func part1PrelimTests() {
 			log.Fatal("Aborting.")
 		}
 	}
+	// A setting whose amps never halt is skipped rather than run forever
+	if _, err := thrust("1105,1,0", []int{0, 1, 2, 3, 4}); !errors.Is(err, ErrBudgetExceeded) {
+		log.Fatalf("Expected a runaway amp to exceed its budget, got %v", err)
+	}
+	// An amp that halts without output fails the setting instead of crashing
+	if _, err := thrust("3,0,3,0,99", []int{0, 1, 2, 3, 4}); !errors.Is(err, ErrNoOutput) {
+		log.Fatalf("Expected a silent amp to give no output, got %v", err)
+	}
 	log.Printf("Day %d, part 1 prelim tests passed.\n", day)
 }
 
@@ -46,113 +186,146 @@ func part2PrelimTests() {
 			log.Printf("Expected thrust %d with setting %s, got %d with setting %s", test.output, test.settings, max_thrust, settings)
 			log.Fatal("Aborting.")
 		}
+		// The concurrent amps must agree with the stepped ones
+		var phases []int
+		for _, c := range test.settings {
+			phases = append(phases, int(c-'0'))
+		}
+		if thr := thrustConcurrent(test.program, phases); thr != test.output {
+			log.Println("Failed test #" + strconv.Itoa(id))
+			log.Printf("Expected concurrent thrust %d with setting %s, got %d", test.output, test.settings, thr)
+			log.Fatal("Aborting.")
+		}
+	}
+	// Amp A halting with no output leaves the others waiting for ever; amps that never stop
+	// outputting use up their budgets
+	if _, err := thrustPart2("3,0,3,0,99", []int{5, 6, 7, 8, 9}); !errors.Is(err, ErrNoOutput) {
+		log.Fatalf("Expected stuck amps to give no output, got %v", err)
+	}
+	if _, err := thrustPart2("104,1,1105,1,0", []int{5, 6, 7, 8, 9}); !errors.Is(err, ErrBudgetExceeded) {
+		log.Fatalf("Expected endlessly outputting amps to exceed their budget, got %v", err)
 	}
 	log.Printf("Day %d, part 2 prelim tests passed.\n", day)
 }
 
 func runPart1(program string) (int, string) {
-	var max_thrust int
-	var best_setting string
-
-	a_setting := []int{0, 1, 2, 3, 4}
-	p := prmt.New(prmt.IntSlice(a_setting))
-
-	for p.Next() {
-		thr := thrust(program, a_setting)
-		if thr > max_thrust {
-			max_thrust = thr
-			best_setting = ""
-			for _, s := range a_setting {
-				best_setting += strconv.Itoa(s)
-			}
-		}
-	}
-	return max_thrust, best_setting
+	return bestSetting(sweepBest(permutationsOf(0, 1, 2, 3, 4), 0, func(settings []int) (int, error) { return thrust(program, settings) }))
 }
 
 func runPart2(program string) (int, string) {
-	var max_thrust int
-	var best_setting string
-
-	a_setting := []int{9, 8, 7, 6, 5}
-	p := prmt.New(prmt.IntSlice(a_setting))
-
-	for p.Next() {
-		thr := thrustPart2(program, a_setting)
-		if thr > max_thrust {
-			max_thrust = thr
-			best_setting = ""
-			for _, s := range a_setting {
-				best_setting += strconv.Itoa(s)
-			}
-		}
-	}
-	return max_thrust, best_setting
+	return bestSetting(sweepBest(permutationsOf(9, 8, 7, 6, 5), 0, func(settings []int) (int, error) { return thrustPart2(program, settings) }))
 }
 
-func prependInput(computer IntComputer, input int) IntComputer {
-	computer.inputs = append([]int{input}, computer.inputs...)
-	return computer
+// The thrust and settings (as digits) of a sweep's best result; zero and no settings if every setting was skipped
+func bestSetting(best SweepResult, ok bool, err error) (int, string) {
+	if err != nil {
+		log.Fatal(err)
+	}
+	var setting string
+	for _, s := range best.candidate {
+		setting += strconv.Itoa(s)
+	}
+	return best.score, setting
 }
 
-func thrustPart2(program string, settings []int) (result int) {
-	var amp [5]IntComputer
+func thrustPart2(program string, settings []int) (result int, err error) {
+	var amp [5]*IntComputer
 	var output int
 
 	// Init amps with their settings
 	for amp_id := 0; amp_id < 5; amp_id++ {
+		var err error
+		amp[amp_id], err = initComputer(program, []int{settings[amp_id]})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Amp A (index 0) gets initial input of zero
+	addInput(amp[0], 0)
+
+	// Run each amp until it needs input, passing its outputs along the ring.
+	// The answer is the last output once amp E halts.
+	lastPassSteps := -1
+	for amp_id := 0; ; amp_id = (amp_id + 1) % 5 {
 		if amp_id == 0 {
-			// Amp A (index 0) gets initial input of zero
-			amp[amp_id] = initComputer(program, []int{0, settings[amp_id]})
-		} else {
-			amp[amp_id] = initComputer(program, []int{settings[amp_id]})
-		}
-	}
-
-	for {
-	AMP_LOOP:
-		for amp_id := 0; amp_id < 5; amp_id++ {
-			for {
-				if amp[amp_id].terminated {
-					return output
-				}
-				//log.Printf("Executing step (ip=%d) for amp %d\n", amp[amp_id].ip, amp_id)
-				amp[amp_id] = runStep(amp[amp_id])
-				// Did this amp generate output?
-				if len(amp[amp_id].outputs) > 0 {
-					// Pop it off
-					outcnt := len(amp[amp_id].outputs)
-					output, amp[amp_id].outputs = amp[amp_id].outputs[outcnt-1], amp[amp_id].outputs[:outcnt-1]
-					//log.Printf("Saw output %d from amp %d\n", output, amp_id)
-
-					next_amp_id := amp_id + 1
-					if next_amp_id == 5 {
-						next_amp_id = 0
-					}
-					// There will only ever be one input stacked up here
-					amp[next_amp_id] = prependInput(amp[next_amp_id], output)
-					//log.Printf("Set amp %d to have inputs: %#v\n", next_amp_id, amp[next_amp_id].inputs)
-
-					continue AMP_LOOP // Process the next amp in the sequence
-				}
+			// A pass around the ring in which no amp ran an instruction means they are all stuck
+			steps := 0
+			for _, a := range amp {
+				steps += a.steps
+			}
+			if steps == lastPassSteps {
+				return 0, computerError(ErrNoOutput, amp[4], "no amp can run before amp E halts")
 			}
+			lastPassSteps = steps
+		}
+		next_amp_id := (amp_id + 1) % 5
+		for {
+			remaining := ampStepBudget - amp[amp_id].steps
+			if remaining <= 0 {
+				return 0, computerError(ErrBudgetExceeded, amp[amp_id], fmt.Sprintf("step limit of %d reached", ampStepBudget))
+			}
+			reason, err := resumeContext(context.Background(), amp[amp_id], Budget{maxSteps: remaining})
+			if err != nil {
+				return 0, err
+			}
+			if reason == Output {
+				// Pop it off and hand it to the next amp
+				output, _ = popOutput(amp[amp_id])
+				addInput(amp[next_amp_id], output)
+				continue
+			}
+			if reason == Halted && amp_id == 4 {
+				return output, nil
+			}
+			break // Waiting for input (or halted): move on to the next amp
 		}
 	}
+}
+
+// Same as thrustPart2, but each amp runs on its own goroutine, connected in a ring of channels
+func thrustConcurrent(program string, settings []int) int {
+	var ring [5]chan int
+	for i := range ring {
+		ring[i] = make(chan int, 1) // room for amp E's last output, which amp A never reads
+	}
 
-	return 8675309 // Maybe Jenny can help debug?
+	machines := make([]Machine, 5)
+	for amp_id := 0; amp_id < 5; amp_id++ {
+		amp, err := initComputer(program, []int{settings[amp_id]})
+		if err != nil {
+			log.Fatal(err)
+		}
+		machines[amp_id] = Machine{computer: amp, in: ring[amp_id], out: ring[(amp_id+1)%5]}
+	}
+	ring[0] <- 0 // Amp A gets initial input of zero
+
+	if err := runConcurrently(machines...); err != nil {
+		log.Fatal(err)
+	}
+	return <-ring[0]
 }
 
-func thrust(program string, settings []int) (result int) {
-	var amp IntComputer
+func thrust(program string, settings []int) (result int, err error) {
 	var output int
 
 	for amp_id := 0; amp_id < 5; amp_id++ {
-		amp = initComputer(program, []int{output, settings[amp_id]})
-		amp = run(amp)
+		amp, err := initComputer(program, []int{settings[amp_id], output})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runContext(context.Background(), amp, Budget{maxSteps: ampStepBudget}); err != nil {
+			return 0, err
+		}
+		if !amp.terminated {
+			return 0, computerError(ErrNoInput, amp, "")
+		}
+		if len(amp.outputs) == 0 {
+			return 0, computerError(ErrNoOutput, amp, "")
+		}
 		output = amp.outputs[len(amp.outputs)-1]
 	}
 
-	return output
+	return output, nil
 }
 
 func part1() {
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"strconv"
+	"testing"
+	"time"
 )
 
 const day int = 9
@@ -24,9 +31,160 @@ func prelimTests() {
 			log.Fatal("Failed test #" + strconv.Itoa(id))
 		}
 	}
+	budgetTests(tests[0].input, tests[0].output)
+	overflowTests(tests[1].input)
+	saveStateTests()
+	asciiTests()
 	log.Println("Prelim tests passed.")
 }
 
+// The big multiplication example fits in an int, but squaring 2^32 doesn't: checked mode
+// must stop at the MUL, and the big.Int computer must get the exact answer.
+func overflowTests(fits string) {
+	computer, _ := initComputer(fits, nil)
+	enableOverflowChecks(computer)
+	if err := run(computer); err != nil {
+		log.Fatal(err)
+	}
+	if d, err := compareArithmetic(fits, nil); d != nil || err != nil {
+		log.Fatalf("Expected native and exact runs to agree, got %v (%v)", d, err)
+	}
+
+	overflows := "1102,4294967296,4294967296,7,4,7,99,0"
+	computer, _ = initComputer(overflows, nil)
+	enableOverflowChecks(computer)
+	err := run(computer)
+	var overflow *OverflowError
+	if !errors.Is(err, ErrOverflow) || !errors.As(err, &overflow) || overflow.Opcode != 2 || computer.ip != 0 {
+		log.Fatalf("Expected an overflow in the MUL at ip 0, got %v", err)
+	}
+
+	exact, _ := initBigComputer(overflows, nil)
+	if err := runBig(exact); err != nil || len(exact.outputs) != 1 || exact.outputs[0].String() != "18446744073709551616" {
+		log.Fatalf("Expected 2^64 from the big.Int computer, got %v (%v)", exact.outputs, err)
+	}
+	d, err := compareArithmetic(overflows, nil)
+	if err != nil || d == nil || d.Step != 1 || d.Addr != 7 || d.Native != 0 {
+		log.Fatalf("Expected the runs to diverge writing [7] at step 1, got %v (%v)", d, err)
+	}
+}
+
+// A run stopped by its budget can be picked up again and finish as if never stopped
+func budgetTests(program string, output []int) {
+	computer, err := initComputer(program, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = runContext(context.Background(), computer, Budget{maxSteps: 10})
+	if !errors.Is(err, ErrBudgetExceeded) || computer.steps != 10 {
+		log.Fatalf("Expected the step limit to stop the run after 10 instructions, got %d (%v)", computer.steps, err)
+	}
+	if err := runContext(context.Background(), computer, Budget{deadline: time.Now().Add(time.Minute)}); err != nil {
+		log.Fatal(err)
+	}
+	if !sliceMatch(computer.outputs, output) {
+		log.Fatalf("Expected %d after resuming, got %d", output, computer.outputs)
+	}
+
+	// Running out of input is an error for a run meant to finish
+	starved, _ := initComputer("104,1,3,0,99", nil)
+	if err := runToHalt(starved); !errors.Is(err, ErrNoInput) || !sliceMatch(starved.outputs, []int{1}) {
+		log.Fatalf("Expected the run to fail for want of input after outputting 1, got %v (%v)", starved.outputs, err)
+	}
+
+	// Cancellation stops even a program that never reads input or writes output
+	looping, _ := initComputer("1105,1,0", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := runContext(ctx, looping, Budget{}); !errors.Is(err, ErrBudgetExceeded) {
+		log.Fatalf("Expected cancellation to stop the loop, got %v", err)
+	}
+}
+
+// A computer saved while waiting for input, then loaded and resumed, ends up where an
+// uninterrupted run does, still checking for overflow
+func saveStateTests() {
+	// OUT #5; IN [13]; MUL [13], #3, [13]; OUT [13]; HALT
+	program := "104,5,3,13,1002,13,3,13,4,13,99,0,0,0"
+	straight, _ := initComputer(program, []int{7})
+	if err := run(straight); err != nil {
+		log.Fatal(err)
+	}
+
+	paused, _ := initComputer(program, nil)
+	enableOverflowChecks(paused)
+	if reason, err := resume(paused); err != nil || reason != Output {
+		log.Fatalf("Expected the first output, got %v (%v)", reason, err)
+	}
+	if reason, err := resume(paused); err != nil || reason != NeedsInput {
+		log.Fatalf("Expected the computer to wait for input, got %v (%v)", reason, err)
+	}
+	var saved bytes.Buffer
+	if err := saveComputer(paused, &saved); err != nil {
+		log.Fatal(err)
+	}
+	checkpoint := saved.Bytes()
+	loaded, err := loadComputer(bytes.NewReader(checkpoint))
+	if err != nil {
+		log.Fatal(err)
+	}
+	addInput(loaded, 7)
+	if err := run(loaded); err != nil || !sliceMatch(loaded.outputs, straight.outputs) || loaded.steps != straight.steps {
+		log.Fatalf("Expected %d after %d steps from the loaded computer, got %d after %d (%v)", straight.outputs, straight.steps, loaded.outputs, loaded.steps, err)
+	}
+
+	// 3 * 2^62 overflows, so the loaded computer must still be checking
+	loaded, _ = loadComputer(bytes.NewReader(checkpoint))
+	addInput(loaded, 1<<62)
+	if err := run(loaded); !errors.Is(err, ErrOverflow) {
+		log.Fatalf("Expected the loaded computer to check for overflow, got %v", err)
+	}
+}
+
+// Text output splits into lines, with values too big to be characters kept apart
+func asciiTests() {
+	computer, _ := initComputer("104,72,104,105,104,10,104,1000,99", nil)
+	if err := run(computer); err != nil {
+		log.Fatal(err)
+	}
+	if lines, values := readASCIIOutput(computer); len(lines) != 1 || lines[0] != "Hi" || !sliceMatch(values, []int{1000}) || len(computer.outputs) != 0 {
+		log.Fatalf("Expected line Hi and value 1000, got %q and %d", lines, values)
+	}
+
+	// Printed as they come, a value splits the line it interrupts
+	var printed []string
+	out := ASCIIOutput{
+		onLine:  func(line string) { printed = append(printed, line) },
+		onValue: func(value int) { printed = append(printed, strconv.Itoa(value)) },
+	}
+	for _, value := range []int{'A', 1000, '\n', 'B', '\n', -1, '\n'} {
+		out.Write(value)
+	}
+	if fmt.Sprint(printed) != "[A 1000 B -1 ]" {
+		log.Fatalf("Expected A, 1000, B, -1 and an empty line in order, got %q", printed)
+	}
+
+	// IN [100]; OUT [100]; EQ [100], #10, [101]; JF [101], #0; HALT: echoes one line
+	echo, _ := initComputer("3,100,4,100,1008,100,10,101,1006,101,0,99", nil)
+	if err := addASCIICommand(echo, "Hi"); err != nil {
+		log.Fatal(err)
+	}
+	if err := addASCIICommand(echo, "there\n"); err != nil {
+		log.Fatal(err)
+	}
+	// Text that isn't ASCII is refused whole
+	if err := addASCIICommand(echo, "café"); !errors.Is(err, ErrNotASCII) || len(echo.inputs) != 9 {
+		log.Fatalf("Expected café to be refused with nothing queued, got %v", err)
+	}
+	if err := run(echo); err != nil {
+		log.Fatal(err)
+	}
+	lines, values := readASCIIOutput(echo)
+	if len(lines) != 1 || lines[0] != "Hi" || len(values) != 0 || len(echo.inputs) != 6 {
+		log.Fatalf("Expected the command echoed with its newline, leaving the next queued, got %q %d %d", lines, values, echo.inputs)
+	}
+}
+
 func sliceMatch(s1, s2 []int) (match bool) {
 	if len(s1) != len(s2) {
 		return false
@@ -39,14 +197,24 @@ func sliceMatch(s1, s2 []int) (match bool) {
 }
 
 func runPart1(input string) []int {
-	computer := initComputer(input, []int{1})
-	computer = run(computer)
+	computer, err := initComputer(input, []int{1})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := runToHalt(computer); err != nil {
+		log.Fatal(err)
+	}
 	return computer.outputs
 }
 
 func runPart2(input string) []int {
-	computer := initComputer(input, []int{2})
-	computer = run(computer)
+	computer, err := initComputer(input, []int{2})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := runToHalt(computer); err != nil {
+		log.Fatal(err)
+	}
 	return computer.outputs
 }
 
@@ -62,11 +230,73 @@ func part2() {
 	log.Printf("Day 9, part 2 solution: %#v", result)
 }
 
+// Measure interpreter throughput on the repo's programs, with and without predecoding,
+// checking both give the same outputs and final memory
+func benchmarks() {
+	boost := getData(day)[0]
+	workloads := []struct {
+		name    string
+		program string
+		inputs  []int
+		patches map[int]int
+	}{
+		{"day 2 gravity assist", getData(2)[0], nil, map[int]int{1: 12, 2: 2}},
+		{"day 5 diagnostic, system 5", getData(5)[0], []int{5}, nil},
+		{"day 7 amplifier, phase 4", getData(7)[0], []int{4, 0}, nil},
+		{"day 9 BOOST, test mode", boost, []int{1}, nil},
+		{"day 9 BOOST, sensor boost mode", boost, []int{2}, nil},
+	}
+
+	for _, workload := range workloads {
+		var results [2]string
+		for p, predecode := range []bool{false, true} {
+			result := testing.Benchmark(func(b *testing.B) {
+				steps := 0
+				var computer *IntComputer
+				for i := 0; i < b.N; i++ {
+					// Only time the run: parsing would swamp the shorter programs
+					b.StopTimer()
+					var err error
+					computer, err = initComputer(workload.program, append([]int(nil), workload.inputs...))
+					if err != nil {
+						b.Fatal(err)
+					}
+					for addr, value := range workload.patches {
+						store(computer, addr, value)
+					}
+					b.StartTimer()
+					if predecode {
+						enablePredecode(computer)
+					}
+					if err := run(computer); err != nil {
+						b.Fatal(err)
+					}
+					steps += computer.steps
+				}
+				_, state := snapshotComputer(computer)
+				results[p] = fmt.Sprint(computer.outputs, state)
+				b.ReportMetric(float64(steps)/b.Elapsed().Seconds(), "instr/s")
+				b.ReportMetric(float64(steps)/float64(b.N), "instr/op")
+			})
+			log.Printf("Benchmark, %s, predecode=%t: %s", workload.name, predecode, result)
+		}
+		if results[0] != results[1] {
+			log.Fatalf("%s: predecoded run differs from interpreted run", workload.name)
+		}
+	}
+}
+
 func main() {
 	//log.SetLevel(log.InfoLevel)
 	//log.SetLevel(log.DebugLevel)
 
+	bench := flag.Bool("bench", false, "also benchmark the interpreter on the day 2, 5, 7 and 9 programs (takes several seconds)")
+	flag.Parse()
+
 	prelimTests()
 	part1()
 	part2()
+	if *bench {
+		benchmarks()
+	}
 }
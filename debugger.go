@@ -0,0 +1,387 @@
+// Interactive step debugger for the ship computer.
+//
+// Type "help" at the prompt for the command list. An empty line repeats the last command.
+// The debugger records the computer's history, so recent instructions can be stepped back
+// through; editing memory or registers starts the history afresh.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Debugger struct {
+	computer    *IntComputer
+	breakpoints map[int]bool // addresses
+	opBreaks    map[int]bool // opcodes
+	watches     map[int]int  // address -> value when last checked
+	out         io.Writer
+}
+
+const debuggerHelp = `Commands:
+  s, step [n]          execute n instructions (default 1)
+  c, continue          run until a breakpoint, watchpoint, halt or missing input
+  rs, rstep [n]        undo n instructions (default 1)
+  rw <addr>            go back to the last instruction that wrote addr
+  ro <n>               go back to the instruction that produced output n (counting from 0)
+  b, break <addr>      break when ip reaches addr
+  bo <opcode|mnemonic> break before any instruction with this opcode (e.g. bo 3, bo OUT)
+  w, watch <addr>      stop when the value at addr changes
+  d, delete <addr>     remove a breakpoint or watchpoint at addr; "d all" removes everything
+  bl                   list breakpoints and watchpoints
+  l, list [addr] [n]   disassemble n instructions from addr (default: 10 from ip)
+  x <addr> [n]         show n memory cells from addr (default 1)
+  set <addr> <value>   write memory
+  ip <value>           set the instruction pointer
+  rb <value>           set the relative base
+  in <values...>       queue input values; "in clear" empties the queue
+  r, regs              show ip, relative base, input queue and outputs
+  q, quit              leave the debugger
+`
+
+// Instructions the debugger can step back through
+const debuggerHistory = 1000000
+
+func newDebugger(computer *IntComputer, out io.Writer) *Debugger {
+	if computer.history == nil {
+		recordHistory(computer, debuggerHistory)
+	}
+	return &Debugger{
+		computer:    computer,
+		breakpoints: make(map[int]bool),
+		opBreaks:    make(map[int]bool),
+		watches:     make(map[int]int),
+		out:         out,
+	}
+}
+
+// Read commands from in until quit or end of input
+func (d *Debugger) repl(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var last string
+	d.showCurrent()
+	for {
+		fmt.Fprint(d.out, "(intcode) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		if quit := d.execute(line); quit {
+			return nil
+		}
+	}
+}
+
+// Run a single debugger command. Returns true when the user asked to quit.
+func (d *Debugger) execute(line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	args, err := parseInts(fields[1:])
+	switch fields[0] {
+	case "q", "quit", "exit":
+		return true
+	case "h", "help", "?":
+		fmt.Fprint(d.out, debuggerHelp)
+	case "s", "step":
+		n := 1
+		if err == nil && len(args) > 0 {
+			n = args[0]
+		}
+		d.run(n)
+	case "c", "continue":
+		d.run(-1)
+	case "rs", "rstep":
+		n := 1
+		if err == nil && len(args) > 0 {
+			n = args[0]
+		}
+		d.back(n)
+	case "rw":
+		if d.needArgs(err, args, 1) {
+			d.backTo(backToWrite(d.computer, args[0]))
+		}
+	case "ro":
+		if d.needArgs(err, args, 1) {
+			d.backTo(backToOutput(d.computer, args[0]))
+		}
+	case "b", "break":
+		if d.needArgs(err, args, 1) {
+			d.breakpoints[args[0]] = true
+		}
+	case "bo":
+		if len(fields) != 2 {
+			fmt.Fprintln(d.out, "usage: bo <opcode|mnemonic>")
+			break
+		}
+		opcode, ok := mnemonicOpcodes(d.computer)[strings.ToUpper(fields[1])]
+		if !ok {
+			if opcode, err = strconv.Atoi(fields[1]); err != nil {
+				fmt.Fprintln(d.out, "unknown opcode", fields[1])
+				break
+			}
+		}
+		d.opBreaks[opcode] = true
+	case "w", "watch":
+		if d.needArgs(err, args, 1) {
+			d.watches[args[0]] = peek(d.computer, args[0])
+		}
+	case "d", "delete":
+		if len(fields) == 2 && fields[1] == "all" {
+			d.breakpoints = make(map[int]bool)
+			d.opBreaks = make(map[int]bool)
+			d.watches = make(map[int]int)
+		} else if d.needArgs(err, args, 1) {
+			delete(d.breakpoints, args[0])
+			delete(d.watches, args[0])
+		}
+	case "bl":
+		d.showBreakpoints()
+	case "l", "list":
+		addr, n := d.computer.ip, 10
+		if err == nil && len(args) > 0 {
+			addr = args[0]
+		}
+		if err == nil && len(args) > 1 {
+			n = args[1]
+		}
+		d.list(addr, n)
+	case "x":
+		if d.needArgs(err, args, 1) {
+			n := 1
+			if len(args) > 1 {
+				n = args[1]
+			}
+			for addr := args[0]; addr < args[0]+n; addr++ {
+				fmt.Fprintf(d.out, "[%d] = %d\n", addr, peek(d.computer, addr))
+			}
+		}
+	case "set":
+		if d.needArgs(err, args, 2) {
+			if args[0] < 0 || args[0] >= computer_ram {
+				fmt.Fprintln(d.out, "address out of range")
+				break
+			}
+			store(d.computer, args[0], args[1])
+			d.editedState()
+			if _, watched := d.watches[args[0]]; watched {
+				d.watches[args[0]] = args[1]
+			}
+		}
+	case "ip":
+		if d.needArgs(err, args, 1) {
+			d.computer.ip = args[0]
+			d.computer.terminated = false // a halted program can be restarted from anywhere
+			d.editedState()
+			d.showCurrent()
+		}
+	case "rb":
+		if d.needArgs(err, args, 1) {
+			d.computer.relativeBase = args[0]
+			d.editedState()
+		}
+	case "in":
+		if len(fields) == 2 && fields[1] == "clear" {
+			d.computer.inputs = nil
+		} else if err != nil {
+			fmt.Fprintln(d.out, err)
+		} else {
+			addInput(d.computer, args...)
+		}
+	case "r", "regs":
+		d.showRegisters()
+	default:
+		fmt.Fprintf(d.out, "unknown command %q; try help\n", fields[0])
+	}
+	return false
+}
+
+// Check a command got at least n integer arguments, complaining if not
+func (d *Debugger) needArgs(err error, args []int, n int) bool {
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return false
+	}
+	if len(args) < n {
+		fmt.Fprintf(d.out, "expected %d argument(s)\n", n)
+		return false
+	}
+	return true
+}
+
+// Execute up to n instructions (n < 0 means no limit), stopping early at breakpoints,
+// watchpoints, halt or missing input
+func (d *Debugger) run(n int) {
+	for i := 0; n < 0 || i < n; i++ {
+		if d.computer.terminated {
+			fmt.Fprintln(d.out, "program has halted")
+			return
+		}
+		pullInput(d.computer)
+		if needsInput(d.computer) {
+			fmt.Fprintln(d.out, "waiting for input; queue some with: in <values>")
+			d.showCurrent()
+			return
+		}
+
+		nOutputs := len(d.computer.outputs)
+		if err := runStep(d.computer); err != nil {
+			fmt.Fprintln(d.out, "error:", err)
+			return
+		}
+		for _, output := range d.computer.outputs[nOutputs:] {
+			fmt.Fprintln(d.out, "output:", output)
+		}
+		if d.computer.terminated {
+			fmt.Fprintln(d.out, "program halted")
+			return
+		}
+		if d.checkWatches() {
+			d.showCurrent()
+			return
+		}
+		if d.breakpoints[d.computer.ip] {
+			fmt.Fprintf(d.out, "breakpoint at %d\n", d.computer.ip)
+			d.showCurrent()
+			return
+		}
+		if op, err := fetch(d.computer); err == nil && d.opBreaks[op%100] {
+			fmt.Fprintf(d.out, "opcode breakpoint (%d)\n", op%100)
+			d.showCurrent()
+			return
+		}
+	}
+	d.showCurrent()
+}
+
+// Undo up to n instructions
+func (d *Debugger) back(n int) {
+	for i := 0; i < n; i++ {
+		if err := stepBack(d.computer); err != nil {
+			fmt.Fprintln(d.out, "no more history")
+			break
+		}
+	}
+	d.resetWatches()
+	d.showCurrent()
+}
+
+// Report where backToWrite or backToOutput left the computer
+func (d *Debugger) backTo(err error) {
+	if err != nil {
+		fmt.Fprintln(d.out, "error:", err)
+		return
+	}
+	d.resetWatches()
+	d.showCurrent()
+}
+
+// Start a fresh history after the user changes state, since older entries no longer undo cleanly
+func (d *Debugger) editedState() {
+	if historyLen(d.computer) > 0 {
+		fmt.Fprintln(d.out, "history cleared")
+	}
+	recordHistory(d.computer, debuggerHistory)
+}
+
+// Take the current values of watched cells as their last seen values, so going back doesn't fire them
+func (d *Debugger) resetWatches() {
+	for addr := range d.watches {
+		d.watches[addr] = peek(d.computer, addr)
+	}
+}
+
+// Report watched cells whose value changed since the last check
+func (d *Debugger) checkWatches() (fired bool) {
+	for _, addr := range sortedKeys(d.watches) {
+		old := d.watches[addr]
+		if value := peek(d.computer, addr); value != old {
+			fmt.Fprintf(d.out, "watchpoint [%d]: %d -> %d\n", addr, old, value)
+			d.watches[addr] = value
+			fired = true
+		}
+	}
+	return fired
+}
+
+// Decode the instruction at addr in the computer's memory
+func disassembleAt(computer *IntComputer, addr int) DisasmLine {
+	words := make([]int, 4)
+	for i := range words {
+		words[i] = peek(computer, addr+i)
+	}
+	line, _ := decodeInstructionFor(computer, words, 0)
+	line.addr = addr
+	return line
+}
+
+func (d *Debugger) showCurrent() {
+	fmt.Fprintf(d.out, "=> %s\n", disassembleAt(d.computer, d.computer.ip))
+}
+
+// Disassemble n instructions starting at addr, marking the instruction pointer and breakpoints
+func (d *Debugger) list(addr, n int) {
+	for i := 0; i < n && addr >= 0; i++ {
+		line := disassembleAt(d.computer, addr)
+		marker := "  "
+		if addr == d.computer.ip {
+			marker = "=>"
+		}
+		if d.breakpoints[addr] {
+			marker = marker[:1] + "*"
+		}
+		fmt.Fprintf(d.out, "%s %s\n", marker, line)
+		addr += len(line.words)
+	}
+}
+
+func (d *Debugger) showRegisters() {
+	c := d.computer
+	fmt.Fprintf(d.out, "ip=%d rb=%d steps=%d terminated=%t history=%d\n", c.ip, c.relativeBase, c.steps, c.terminated, historyLen(c))
+	fmt.Fprintf(d.out, "inputs=%v outputs=%v\n", c.inputs, c.outputs)
+}
+
+func (d *Debugger) showBreakpoints() {
+	for _, addr := range sortedKeys(d.breakpoints) {
+		fmt.Fprintf(d.out, "break %d\n", addr)
+	}
+	for _, opcode := range sortedKeys(d.opBreaks) {
+		info, _ := lookupInstruction(d.computer, opcode)
+		fmt.Fprintf(d.out, "break on opcode %d (%s)\n", opcode, info.name)
+	}
+	for _, addr := range sortedKeys(d.watches) {
+		fmt.Fprintf(d.out, "watch [%d] (currently %d)\n", addr, d.watches[addr])
+	}
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func parseInts(fields []string) ([]int, error) {
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		value, err := strconv.Atoi(strings.TrimSuffix(field, ","))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", field)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,176 @@
+// Disassembler for ship computer programs.
+//
+// A listing shows one instruction per line: its address, the raw words, the mnemonic,
+// the operands and the decoded parameter modes. Operands are written as
+//
+//	[12]   position mode: the value at address 12
+//	#5     immediate mode: the value 5
+//	rb+3   relative mode: the value at relative base + 3
+//
+// Words that don't decode to a valid instruction are listed as DATA.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Opcode for each mnemonic on computer, the reverse of lookupInstruction.
+// computer may be nil, for the built-in instructions only.
+func mnemonicOpcodes(computer *IntComputer) map[string]int {
+	opcodes := make(map[string]int)
+	for opcode, info := range instructionSet {
+		opcodes[info.name] = opcode
+	}
+	if computer != nil {
+		for opcode, info := range computer.customOps {
+			opcodes[info.name] = opcode
+		}
+	}
+	return opcodes
+}
+
+// One line of a listing
+type DisasmLine struct {
+	addr     int
+	words    []int
+	mnemonic string
+	operands []string
+	modes    []ParamMode
+}
+
+func (mode ParamMode) String() string {
+	switch mode {
+	case POS:
+		return "POS"
+	case DIRECT:
+		return "DIRECT"
+	case RELATIVE:
+		return "RELATIVE"
+	}
+	return "ParamMode(" + strconv.Itoa(int(mode)) + ")"
+}
+
+// Write an operand in listing notation
+func formatOperand(mode ParamMode, value int) string {
+	switch mode {
+	case POS:
+		return "[" + strconv.Itoa(value) + "]"
+	case DIRECT:
+		return "#" + strconv.Itoa(value)
+	case RELATIVE:
+		if value < 0 {
+			return "rb" + strconv.Itoa(value)
+		}
+		return "rb+" + strconv.Itoa(value)
+	}
+	return "?" + strconv.Itoa(value)
+}
+
+// Decode the instruction at addr. ok is false when the word there isn't a valid instruction:
+// an unknown opcode, an unknown parameter mode, an immediate-mode write or a truncated instruction.
+func decodeInstruction(program []int, addr int) (line DisasmLine, ok bool) {
+	return decodeInstructionFor(nil, program, addr)
+}
+
+// Decode the instruction at addr, including computer's custom opcodes
+func decodeInstructionFor(computer *IntComputer, program []int, addr int) (line DisasmLine, ok bool) {
+	op := program[addr]
+	opcode, paramModes := decodeOp(op)
+	info, known := lookupInstruction(computer, opcode)
+	if !known || op < 0 || addr+info.params >= len(program) {
+		return dataLine(program, addr), false
+	}
+	// Mode digits beyond the instruction's parameters must be zero
+	if op/100 >= pow10(info.params) {
+		return dataLine(program, addr), false
+	}
+
+	line = DisasmLine{addr: addr, words: program[addr : addr+info.params+1], mnemonic: info.name}
+	for p := 1; p <= info.params; p++ {
+		mode := paramModes[p]
+		if mode > RELATIVE || (p == info.write && mode == DIRECT) {
+			return dataLine(program, addr), false
+		}
+		line.modes = append(line.modes, mode)
+		line.operands = append(line.operands, formatOperand(mode, program[addr+p]))
+	}
+	return line, true
+}
+
+func dataLine(program []int, addr int) DisasmLine {
+	return DisasmLine{addr: addr, words: program[addr : addr+1], mnemonic: "DATA", operands: []string{strconv.Itoa(program[addr])}}
+}
+
+func pow10(n int) int {
+	result := 1
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// Disassemble a whole program by sweeping it from address 0.
+// If executed is not nil, only instructions starting at addresses in it are decoded and everything else is DATA.
+func disassemble(program []int, executed map[int]bool) (lines []DisasmLine) {
+	for addr := 0; addr < len(program); {
+		var line DisasmLine
+		if executed != nil && !executed[addr] {
+			line = dataLine(program, addr)
+		} else {
+			line, _ = decodeInstruction(program, addr)
+		}
+		lines = append(lines, line)
+		addr += len(line.words)
+	}
+	return lines
+}
+
+// Single-line rendering of an instruction, without the raw words
+func (line DisasmLine) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%d: %s %s", line.addr, line.mnemonic, strings.Join(line.operands, ", ")))
+}
+
+// Write lines as an aligned listing
+func writeListing(w io.Writer, lines []DisasmLine) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, line := range lines {
+		words := make([]string, len(line.words))
+		for i, word := range line.words {
+			words[i] = strconv.Itoa(word)
+		}
+		modes := make([]string, len(line.modes))
+		for i, mode := range line.modes {
+			modes[i] = mode.String()
+		}
+		comment := ""
+		if len(modes) > 0 {
+			comment = "; " + strings.Join(modes, ",")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", line.addr, strings.Join(words, " "), line.mnemonic, strings.Join(line.operands, ", "), comment)
+	}
+	return tw.Flush()
+}
+
+// Records the address of each instruction traced
+type executedSet map[int]bool
+
+func (e executedSet) Trace(record TraceRecord) {
+	e[record.IP] = true
+}
+
+// Run a computer to completion (or until it needs input it doesn't have) within budget,
+// recording the address of every instruction executed. A program that outlasts the budget
+// fails with ErrBudgetExceeded, returning what it executed so far.
+func traceExecution(computer *IntComputer, budget Budget) (map[int]bool, error) {
+	executed := make(executedSet)
+	attachTracer(computer, executed)
+	defer attachTracer(computer, nil)
+	err := runContext(context.Background(), computer, budget)
+	return executed, err
+}
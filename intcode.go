@@ -0,0 +1,161 @@
+// Run any ship computer program from the command line.
+//
+// Usage:
+//
+//	go run computer.go computerio.go ascii.go tracer.go disasm.go debugger.go reverse.go profiler.go intcode.go [flags] program-file
+//
+// Standard input feeds the program and its output goes to standard output, either as one
+// number per line (-mode numeric) or as text (-mode ascii).
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Most instructions -disasm runs to tell code from data
+const disasmSteps = 10000000
+
+func main() {
+	mode := flag.String("mode", "numeric", "I/O mode: numeric (integers, one per line) or ascii (text)")
+	memory := flag.Int("mem", computer_ram, "largest address space the program may use")
+	inputs := flag.String("input", "", "comma-separated values to queue before reading standard input")
+	patches := flag.String("patch", "", "comma-separated addr=value memory patches applied before running, e.g. 1=12,2=2")
+	tracePath := flag.String("trace", "", "write a JSON trace of every instruction to this file (- for standard error)")
+	debug := flag.Bool("debug", false, "start the step debugger instead of running; debugger commands come from standard input")
+	disasm := flag.Bool("disasm", false, "print a disassembly of the program instead of running it; with -input, run it on those inputs first and list what didn't execute as DATA")
+	profile := flag.Bool("profile", false, "print an instruction profile to standard error after the program halts")
+	listing := flag.Bool("listing", false, "print a disassembly annotated with execution counts to standard error after the program halts")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: intcode [flags] program-file\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || (*mode != "numeric" && *mode != "ascii") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.SetFlags(0)
+	log.SetPrefix("intcode: ")
+
+	computer_ram = *memory
+	text, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	computer, err := initComputer(string(text), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := applyPatches(computer, *patches); err != nil {
+		log.Fatal(err)
+	}
+	if *inputs != "" {
+		values, err := parseInts(strings.Split(*inputs, ","))
+		if err != nil {
+			log.Fatal("bad -input: ", err)
+		}
+		addInput(computer, values...)
+	}
+	program := append([]int(nil), computer.state[:computer.highWater+1]...)
+
+	if *disasm {
+		var executed map[int]bool
+		if *inputs != "" {
+			executed, err = traceExecution(computer, Budget{maxSteps: disasmSteps})
+			if err != nil {
+				log.Print("tracing stopped early, so some code may be listed as DATA: ", err)
+			}
+		}
+		if err := writeListing(os.Stdout, disassemble(program, executed)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *tracePath != "" {
+		traceFile := os.Stderr
+		if *tracePath != "-" {
+			if traceFile, err = os.Create(*tracePath); err != nil {
+				log.Fatal(err)
+			}
+			defer traceFile.Close()
+		}
+		attachTracer(computer, newJSONTracer(traceFile))
+	}
+
+	if *debug {
+		if err := newDebugger(computer, os.Stdout).repl(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var profiler *Profiler
+	if *profile || *listing {
+		if *tracePath != "" {
+			log.Fatal("-trace can't be used with -profile or -listing")
+		}
+		profiler = newProfiler()
+		attachTracer(computer, profiler)
+	}
+
+	var ascii *ASCIIOutput
+	if *mode == "ascii" {
+		attachInput(computer, newASCIIReaderInput(os.Stdin))
+		ascii = &ASCIIOutput{
+			onLine:  func(line string) { fmt.Println(line) },
+			onValue: func(value int) { fmt.Println(value) },
+		}
+		attachOutput(computer, ascii)
+	} else {
+		attachInput(computer, newReaderInput(os.Stdin))
+		attachOutput(computer, newWriterOutput(os.Stdout))
+	}
+
+	err = run(computer)
+	if ascii != nil && ascii.pending() != "" {
+		fmt.Println(ascii.pending())
+	}
+	if *profile {
+		profiler.writeReport(os.Stderr, program, 20)
+	}
+	if *listing {
+		profiler.writeAnnotatedListing(os.Stderr, program)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !computer.terminated {
+		log.Fatal("program is waiting for input, but standard input has ended")
+	}
+}
+
+// Apply addr=value patches, as given to -patch
+func applyPatches(computer *IntComputer, patches string) error {
+	if patches == "" {
+		return nil
+	}
+	for _, patch := range strings.Split(patches, ",") {
+		parts := strings.SplitN(patch, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("bad patch %q; expected addr=value", patch)
+		}
+		addr, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || addr < 0 || addr >= computer_ram {
+			return fmt.Errorf("bad patch address in %q", patch)
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("bad patch value in %q", patch)
+		}
+		store(computer, addr, value)
+	}
+	return nil
+}
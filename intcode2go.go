@@ -0,0 +1,103 @@
+// Compile ship computer programs to Go source.
+//
+// Usage:
+//
+//	go run computer.go disasm.go cfg.go transpile.go intcode2go.go [flags] program-file...
+//
+// Each non-empty line of each file is a program. A single program becomes one function called
+// -func; several become -func1, -func2, ... plus a map from program text to function, named
+// -func followed by "Table". The generated file needs computer.go to build.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	name := flag.String("func", "program", "name of the generated function")
+	pkg := flag.String("package", "main", "package clause of the generated file")
+	outPath := flag.String("o", "", "write the generated file here instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: intcode2go [flags] program-file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.SetFlags(0)
+	log.SetPrefix("intcode2go: ")
+
+	var sources []string
+	for _, path := range flag.Args() {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, line := range strings.Split(string(text), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				sources = append(sources, line)
+			}
+		}
+	}
+	if len(sources) == 0 {
+		log.Fatal("no programs found")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by intcode2go from %s. DO NOT EDIT.\n\n", strings.Join(flag.Args(), ", "))
+	fmt.Fprintf(&b, "package %s\n\n", *pkg)
+	funcNames := make([]string, len(sources))
+	for i, source := range sources {
+		computer, err := initComputer(source, nil)
+		if err != nil {
+			log.Fatalf("program %d: %v", i+1, err)
+		}
+		program := computer.state[:computer.highWater+1]
+		funcNames[i] = *name
+		if len(sources) > 1 {
+			funcNames[i] = fmt.Sprintf("%s%d", *name, i+1)
+		}
+		code, err := transpile(program, funcNames[i])
+		if err != nil {
+			log.Fatalf("program %d: %v", i+1, err)
+		}
+		b.WriteString(code)
+		b.WriteString("\n")
+	}
+	if len(sources) > 1 {
+		fmt.Fprintf(&b, "// The compiled programs by their source text\n")
+		fmt.Fprintf(&b, "var %sTable = map[string]func(InputSource, OutputSink) (*IntComputer, error){\n", *name)
+		for i, source := range sources {
+			fmt.Fprintf(&b, "\t%q: %s,\n", source, funcNames[i])
+		}
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(out)
+	w.Write(src)
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
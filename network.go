@@ -0,0 +1,185 @@
+// Packet network of ship computers.
+//
+// Each computer on a network boots with its address as its first input. It sends a packet by
+// outputting three values: the destination address, X and Y. Packets queue up at their
+// destination and are read as X then Y; a computer that reads with nothing queued gets -1.
+//
+// The network is stepped in rounds. In each round every computer, in address order, is fed its
+// queued packets (or a single -1) and runs until it needs more input. Packets sent during a
+// round are queued immediately, so the whole network is deterministic. A machine that runs
+// more than turnSteps instructions in one turn without waiting for input fails the round.
+// A packet its sender halts or fails partway through is dropped, marked Partial.
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Default for Network.turnSteps
+const defaultTurnSteps = 1000000
+
+type Packet struct {
+	Src, Dest, X, Y int
+	Partial         bool // the sender stopped before sending X or Y; values not sent are 0
+}
+
+// Called for packets sent to an intercepted address. Return true to go on and deliver the
+// packet as usual, false to swallow it.
+type PacketHook func(network *Network, packet Packet) bool
+
+type Network struct {
+	machines  []*IntComputer
+	queues    [][]Packet         // packets waiting for each machine
+	hooks     map[int]PacketHook // intercepted destination addresses
+	monitors  []func(Packet)     // see every packet sent
+	dropped   []Packet           // sent to addresses with no machine and no hook
+	rounds    int
+	stopped   bool
+	turnSteps int // most instructions a machine may run in one turn
+}
+
+// Boot size copies of program, with addresses 0 to size-1
+func newNetwork(program string, size int) (*Network, error) {
+	network := &Network{
+		machines:  make([]*IntComputer, size),
+		queues:    make([][]Packet, size),
+		hooks:     make(map[int]PacketHook),
+		turnSteps: defaultTurnSteps,
+	}
+	for addr := range network.machines {
+		computer, err := initComputer(program, []int{addr})
+		if err != nil {
+			return nil, err
+		}
+		network.machines[addr] = computer
+	}
+	return network, nil
+}
+
+// Pass packets sent to addr through hook before delivering them
+func (network *Network) intercept(addr int, hook PacketHook) {
+	network.hooks[addr] = hook
+}
+
+// Call monitor with every packet sent, before it is routed
+func (network *Network) observe(monitor func(Packet)) {
+	network.monitors = append(network.monitors, monitor)
+}
+
+// Make run return at the end of the current round. Meant to be called from hooks and monitors.
+func (network *Network) stop() {
+	network.stopped = true
+}
+
+// Route a packet: run monitors and any hook for its destination, then queue it
+func (network *Network) send(packet Packet) {
+	for _, monitor := range network.monitors {
+		monitor(packet)
+	}
+	if hook, ok := network.hooks[packet.Dest]; ok && !hook(network, packet) {
+		return
+	}
+	if packet.Dest < 0 || packet.Dest >= len(network.machines) {
+		network.dropped = append(network.dropped, packet)
+		return
+	}
+	network.queues[packet.Dest] = append(network.queues[packet.Dest], packet)
+}
+
+// True when no machine has packets waiting
+func (network *Network) quiet() bool {
+	for _, queue := range network.queues {
+		if len(queue) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Give every running machine one turn. Returns how many packets were sent.
+func (network *Network) round() (sent int, err error) {
+	network.rounds++
+	for addr, computer := range network.machines {
+		if computer.terminated {
+			continue
+		}
+
+		if len(network.queues[addr]) == 0 {
+			addInput(computer, -1)
+		}
+		for _, packet := range network.queues[addr] {
+			addInput(computer, packet.X, packet.Y)
+		}
+		network.queues[addr] = nil
+
+		turnStart := computer.steps
+		for {
+			budget := Budget{maxSteps: network.turnSteps - (computer.steps - turnStart)}
+			if budget.maxSteps <= 0 {
+				return sent, fmt.Errorf("machine %d: %w", addr, computerError(ErrBudgetExceeded, computer, fmt.Sprintf("step limit of %d per turn reached", network.turnSteps)))
+			}
+			reason, err := resumeContext(context.Background(), computer, budget)
+			if err != nil {
+				network.dropPartial(addr, computer)
+				return sent, fmt.Errorf("machine %d: %w", addr, err)
+			}
+			if reason != Output {
+				if computer.terminated {
+					network.dropPartial(addr, computer)
+				}
+				break
+			}
+			if len(computer.outputs) == 3 {
+				dest, _ := popOutput(computer)
+				x, _ := popOutput(computer)
+				y, _ := popOutput(computer)
+				network.send(Packet{Src: addr, Dest: dest, X: x, Y: y})
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// Drop the packet a machine that has stopped was partway through sending, if any
+func (network *Network) dropPartial(addr int, computer *IntComputer) {
+	if len(computer.outputs) == 0 {
+		return
+	}
+	packet := Packet{Src: addr, Dest: computer.outputs[0], Partial: true}
+	if len(computer.outputs) > 1 {
+		packet.X = computer.outputs[1]
+	}
+	computer.outputs = nil
+	network.dropped = append(network.dropped, packet)
+}
+
+// Run rounds until a hook or monitor calls stop, every machine halts, or maxRounds
+// have run (maxRounds <= 0 means no limit). Returns true if the network was stopped.
+func (network *Network) run(maxRounds int) (stopped bool, err error) {
+	for n := 0; maxRounds <= 0 || n < maxRounds; n++ {
+		if _, err := network.round(); err != nil {
+			return false, err
+		}
+		if network.stopped {
+			network.stopped = false
+			return true, nil
+		}
+		if network.halted() {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// True when every machine has halted
+func (network *Network) halted() bool {
+	for _, computer := range network.machines {
+		if !computer.terminated {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+// Instruction-level profiler for the ship computer.
+//
+// A Profiler is a Tracer: attach it with attachTracer, run the program, then print a report.
+// It counts executions per address and per opcode, memory reads and writes per address,
+// and taken backward jumps, which mark the loops a program spends its time in.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+type Profiler struct {
+	instructions int
+	byAddr       map[int]int
+	byOpcode     map[int]int
+	names        map[int]string // mnemonic of each opcode seen
+	reads        map[int]int
+	writes       map[int]int
+	backEdges    map[backEdge]int
+}
+
+// A taken jump to an address at or before the jump itself
+type backEdge struct {
+	from, to int
+}
+
+func newProfiler() *Profiler {
+	return &Profiler{
+		byAddr:    make(map[int]int),
+		byOpcode:  make(map[int]int),
+		names:     make(map[int]string),
+		reads:     make(map[int]int),
+		writes:    make(map[int]int),
+		backEdges: make(map[backEdge]int),
+	}
+}
+
+func (p *Profiler) Trace(record TraceRecord) {
+	p.instructions++
+	p.byAddr[record.IP]++
+	p.byOpcode[record.Opcode]++
+	p.names[record.Opcode] = record.Mnemonic
+	for _, addr := range record.Reads {
+		p.reads[addr]++
+	}
+	for _, write := range record.Writes {
+		p.writes[write.Addr]++
+	}
+
+	if (record.Opcode == 5 || record.Opcode == 6) && len(record.Operands) == 2 {
+		cond, target := record.Operands[0], record.Operands[1]
+		taken := (record.Opcode == 5) == (cond != 0)
+		if taken && target <= record.IP {
+			p.backEdges[backEdge{record.IP, target}]++
+		}
+	}
+}
+
+// A count attached to an address (or opcode), for sorting
+type profileCount struct {
+	key, count int
+}
+
+// Entries of counts, busiest first; ties in key order
+func sortedCounts(counts map[int]int) []profileCount {
+	sorted := make([]profileCount, 0, len(counts))
+	for key, count := range counts {
+		sorted = append(sorted, profileCount{key, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	return sorted
+}
+
+func percent(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(count) / float64(total)
+}
+
+// Print the profile, showing at most top entries per section.
+// program is the memory to disassemble hot addresses from; it may be nil.
+func (p *Profiler) writeReport(w io.Writer, program []int, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	limit := func(n int) int {
+		if top > 0 && n > top {
+			return top
+		}
+		return n
+	}
+
+	fmt.Fprintf(tw, "%d instructions executed\n\n", p.instructions)
+
+	fmt.Fprintln(tw, "Opcode\tName\tCount\t%\t")
+	for _, c := range sortedCounts(p.byOpcode) {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%.1f\t\n", c.key, p.names[c.key], c.count, percent(c.count, p.instructions))
+	}
+
+	fmt.Fprintln(tw, "\nHot address\tCount\t%\tInstruction\t")
+	byAddr := sortedCounts(p.byAddr)
+	for _, c := range byAddr[:limit(len(byAddr))] {
+		instruction := ""
+		if c.key < len(program) {
+			line, _ := decodeInstruction(program, c.key)
+			instruction = line.mnemonic
+			for i, operand := range line.operands {
+				if i == 0 {
+					instruction += " " + operand
+				} else {
+					instruction += ", " + operand
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%.1f\t%s\t\n", c.key, c.count, percent(c.count, p.instructions), instruction)
+	}
+
+	fmt.Fprintln(tw, "\nLoop (jump -> target)\tTimes taken\tBody size\t")
+	edges := make([]backEdge, 0, len(p.backEdges))
+	for edge := range p.backEdges {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if p.backEdges[edges[i]] != p.backEdges[edges[j]] {
+			return p.backEdges[edges[i]] > p.backEdges[edges[j]]
+		}
+		return edges[i].from < edges[j].from
+	})
+	for _, edge := range edges[:limit(len(edges))] {
+		fmt.Fprintf(tw, "%d -> %d\t%d\t%d\t\n", edge.from, edge.to, p.backEdges[edge], edge.from-edge.to+1)
+	}
+
+	fmt.Fprintln(tw, "\nMemory address\tReads\tWrites\t")
+	traffic := make(map[int]int)
+	for addr, n := range p.reads {
+		traffic[addr] += n
+	}
+	for addr, n := range p.writes {
+		traffic[addr] += n
+	}
+	byTraffic := sortedCounts(traffic)
+	for _, c := range byTraffic[:limit(len(byTraffic))] {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t\n", c.key, p.reads[c.key], p.writes[c.key])
+	}
+	return tw.Flush()
+}
+
+// Print a disassembly of program with execution counts in the left margin.
+// Addresses that never ran are listed as DATA.
+func (p *Profiler) writeAnnotatedListing(w io.Writer, program []int) error {
+	executed := make(map[int]bool, len(p.byAddr))
+	for addr := range p.byAddr {
+		executed[addr] = true
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, line := range disassemble(program, executed) {
+		count := ""
+		if n := p.byAddr[line.addr]; n > 0 {
+			count = fmt.Sprintf("%d", n)
+		}
+		ops := ""
+		for i, operand := range line.operands {
+			if i > 0 {
+				ops += ", "
+			}
+			ops += operand
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", count, line.addr, line.mnemonic, ops)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+// Reverse execution for the ship computer.
+//
+// Once recordHistory is called, each instruction a computer executes leaves an entry in an
+// undo log: the memory it overwrote, the instruction pointer, relative base and step count
+// before it ran, and the input it consumed or output it produced. stepBack undoes the latest
+// instruction; backToWrite and backToOutput undo as many as it takes to get back to the
+// instruction that last wrote an address, or that produced a given output.
+//
+// Consumed inputs go back on the front of the input queue, including ones pulled from an
+// InputSource. Outputs sent to an OutputSink can't be taken back. Changes not made by an
+// instruction (a store from outside, setting ip directly) aren't logged, so call
+// recordHistory again after making them to start a fresh log.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNoHistory = errors.New("not in recorded history")
+
+// Start logging instructions so they can be undone, dropping any earlier log.
+// With limit > 0, only the latest limit instructions can be undone.
+func recordHistory(computer *IntComputer, limit int) {
+	computer.history = &History{limit: limit}
+}
+
+// Stop logging and forget the log
+func stopHistory(computer *IntComputer) {
+	computer.history = nil
+}
+
+// Instructions that can currently be undone
+func historyLen(computer *IntComputer) int {
+	if computer.history == nil {
+		return 0
+	}
+	return len(computer.history.entries)
+}
+
+// Undo the latest instruction. A halted computer is brought back to before the instruction
+// that led to its HALT.
+func stepBack(computer *IntComputer) error {
+	if historyLen(computer) == 0 {
+		return computerError(ErrNoHistory, computer, "no instructions to undo")
+	}
+	undoLast(computer)
+	return nil
+}
+
+// Undo instructions until the one that last wrote addr is next to run again
+func backToWrite(computer *IntComputer, addr int) error {
+	return backTo(computer, fmt.Sprintf("no recorded write to %d", addr), func(entry *undoEntry) bool {
+		for _, write := range entry.writes {
+			if write.Addr == addr {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Undo instructions until the one that produced output n (counting from 0 since
+// recordHistory) is next to run again
+func backToOutput(computer *IntComputer, n int) error {
+	return backTo(computer, fmt.Sprintf("no recorded output #%d", n), func(entry *undoEntry) bool {
+		return entry.output == n
+	})
+}
+
+// Undo instructions up to and including the latest one matching found.
+// If none does, the computer is left unchanged.
+func backTo(computer *IntComputer, missing string, found func(entry *undoEntry) bool) error {
+	for i := historyLen(computer) - 1; i >= 0; i-- {
+		if found(&computer.history.entries[i]) {
+			for historyLen(computer) > i {
+				undoLast(computer)
+			}
+			return nil
+		}
+	}
+	return computerError(ErrNoHistory, computer, missing)
+}
+
+// Pop the latest entry off the log and undo it
+func undoLast(computer *IntComputer) {
+	h := computer.history
+	entry := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+
+	for i := len(entry.writes) - 1; i >= 0; i-- {
+		write := entry.writes[i]
+		computer.state[write.Addr] = write.Old // store grew state to hold it
+		if write.Addr < len(computer.cache) {
+			computer.cache[write.Addr].valid = false
+		}
+	}
+	computer.ip = entry.ip
+	computer.relativeBase = entry.relativeBase
+	computer.highWater = entry.highWater
+	computer.steps = entry.steps
+	computer.terminated = false
+	if entry.input != nil {
+		computer.inputs = append([]int{*entry.input}, computer.inputs...)
+	}
+	if entry.output >= 0 {
+		h.outputs--
+		// Outputs are collected and popped in order, so an output not yet popped is the last one
+		if entry.collected && len(computer.outputs) > 0 {
+			computer.outputs = computer.outputs[:len(computer.outputs)-1]
+		}
+	}
+}
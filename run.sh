@@ -1,10 +1,14 @@
-#go get github.com/gitchander/permutation
 #go run aocutil.go day1.go
-#go run aocutil.go day2.go
+#go run aocutil.go computer.go symbolic.go sweep.go day2.go
 #go run aocutil.go day3.go
 #go run aocutil.go day4.go
-#go run aocutil.go computer.go day5.go
+#go run aocutil.go computer.go disasm.go asm.go reverse.go cfg.go debugger.go tracer.go profiler.go day5.go
 #go run aocutil.go day6.go
+#go run aocutil.go computer.go computerio.go concurrent.go network.go sweep.go day7.go
 #go run aocutil.go day8.go
-#go run aocutil.go computer.go day9.go
+#go run aocutil.go computer.go bigcomputer.go savestate.go ascii.go day9.go
+#go run aocutil.go computer.go bigcomputer.go savestate.go ascii.go day9.go -bench
+#echo 2 | go run computer.go computerio.go ascii.go tracer.go disasm.go debugger.go reverse.go profiler.go intcode.go data/day9
+#go run computer.go disasm.go cfg.go transpile.go intcode2go.go -func example -o transpiled_examples.go data/transpile_examples
+#go run computer.go computerio.go transpiled_examples.go transpilecheck.go
 go run aocutil.go day10.go
@@ -0,0 +1,108 @@
+// Saving and restoring complete computer state.
+//
+// A save file is a JSON object holding everything needed to resume a paused machine:
+// memory up to the highest address touched, the instruction pointer, the relative base,
+// the step count, pending inputs, buffered outputs and whether overflow checks are on.
+// Input sources, output sinks and tracers are not saved; attach them again after loading.
+// Nor are predecoding, history and self-modification watches, which can be enabled afresh.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Bump when the save format changes
+const saveVersion = 2
+
+var ErrSaveFormat = errors.New("bad computer save file")
+
+type savedComputer struct {
+	Version      int   `json:"version"`
+	Memory       []int `json:"memory"`
+	IP           int   `json:"ip"`
+	RelativeBase int   `json:"relative_base"`
+	Terminated   bool  `json:"terminated"`
+	Steps        int   `json:"steps"`
+	Inputs       []int `json:"inputs"`
+	Outputs      []int `json:"outputs"`
+	Checked      bool  `json:"checked"`
+}
+
+// Write the computer's full state to w
+func saveComputer(computer *IntComputer, w io.Writer) error {
+	saved := savedComputer{
+		Version:      saveVersion,
+		Memory:       computer.state[:computer.highWater+1],
+		IP:           computer.ip,
+		RelativeBase: computer.relativeBase,
+		Terminated:   computer.terminated,
+		Steps:        computer.steps,
+		Inputs:       computer.inputs,
+		Outputs:      computer.outputs,
+		Checked:      computer.checked,
+	}
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Read a computer saved by saveComputer
+func loadComputer(r io.Reader) (*IntComputer, error) {
+	var saved savedComputer
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSaveFormat, err)
+	}
+	if saved.Version != saveVersion {
+		return nil, fmt.Errorf("%w: version %d, expected %d", ErrSaveFormat, saved.Version, saveVersion)
+	}
+	if len(saved.Memory) > computer_ram {
+		return nil, fmt.Errorf("%w: %d memory cells, limit is %d", ErrSaveFormat, len(saved.Memory), computer_ram)
+	}
+
+	computer := &IntComputer{
+		state:        saved.Memory,
+		highWater:    len(saved.Memory) - 1,
+		ip:           saved.IP,
+		relativeBase: saved.RelativeBase,
+		terminated:   saved.Terminated,
+		steps:        saved.Steps,
+		inputs:       saved.Inputs,
+		outputs:      saved.Outputs,
+		checked:      saved.Checked,
+	}
+	return computer, nil
+}
+
+// Save the computer to path. The file is replaced atomically, so an interrupted save
+// leaves the previous checkpoint intact.
+func saveComputerFile(computer *IntComputer, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := saveComputer(computer, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load a computer saved with saveComputerFile
+func loadComputerFile(path string) (*IntComputer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return loadComputer(file)
+}
@@ -0,0 +1,279 @@
+// Parameter sweeps: trying a program on every candidate in a space, on a pool of workers.
+//
+// A Space numbers its candidates from 0, so the results don't depend on which worker finished
+// first: the best candidate is the highest scoring one that comes first in the space, and
+// matches come back in the space's order. Candidates whose runs exceed their budget are skipped.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+var ErrNoOutput = errors.New("program gave no output")
+
+// Candidates in a fixed order. At returns a new slice each time.
+type Space interface {
+	Size() int
+	At(i int) []int
+}
+
+// Single values from min to max
+type Range struct {
+	min, max int
+}
+
+// Every ordering of some values, in lexicographic order of their positions
+type Permutations struct {
+	values []int
+}
+
+// Every combination of one candidate from each space, joined together. The last space varies fastest.
+type Product []Space
+
+func valueRange(min, max int) Range {
+	return Range{min, max}
+}
+
+func permutationsOf(values ...int) Permutations {
+	return Permutations{values}
+}
+
+func product(spaces ...Space) Product {
+	return spaces
+}
+
+func (r Range) Size() int {
+	if r.max < r.min {
+		return 0
+	}
+	return r.max - r.min + 1
+}
+
+func (r Range) At(i int) []int {
+	return []int{r.min + i}
+}
+
+func (p Permutations) Size() int {
+	size := 1
+	for n := 2; n <= len(p.values); n++ {
+		size *= n
+	}
+	return size
+}
+
+// Decode i as a factorial-base number, whose digits pick each value from those left
+func (p Permutations) At(i int) []int {
+	left := append([]int(nil), p.values...)
+	perm := make([]int, 0, len(left))
+	place := p.Size()
+	for len(left) > 0 {
+		place /= len(left)
+		pick := i / place
+		i %= place
+		perm = append(perm, left[pick])
+		left = append(left[:pick], left[pick+1:]...)
+	}
+	return perm
+}
+
+func (p Product) Size() int {
+	size := 1
+	for _, space := range p {
+		size *= space.Size()
+	}
+	return size
+}
+
+func (p Product) At(i int) []int {
+	parts := make([][]int, len(p))
+	for k := len(p) - 1; k >= 0; k-- {
+		size := p[k].Size()
+		parts[k] = p[k].At(i % size)
+		i /= size
+	}
+	var candidate []int
+	for _, part := range parts {
+		candidate = append(candidate, part...)
+	}
+	return candidate
+}
+
+// Scores a candidate. An error matching ErrBudgetExceeded skips the candidate;
+// any other error stops the sweep.
+type Objective func(candidate []int) (int, error)
+
+// Decides whether a candidate matches, with errors treated as for an Objective
+type Predicate func(candidate []int) (bool, error)
+
+type SweepResult struct {
+	candidate []int
+	score     int
+}
+
+// Evaluate candidates from space on workers goroutines (one per CPU if workers <= 0), handing
+// each score to keep, along with the candidate's index, one at a time. Candidates are started
+// in index order, and once keep returns false no more are started.
+func sweep(space Space, workers int, objective Objective, keep func(i int, candidate []int, score int) bool) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		next     int
+		stopped  bool
+		firstErr error
+	)
+	claim := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped || next >= space.Size() {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := claim(); ok; i, ok = claim() {
+				candidate := space.At(i)
+				score, err := objective(candidate)
+				mu.Lock()
+				switch {
+				case errors.Is(err, ErrBudgetExceeded):
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+					}
+					stopped = true
+				case !keep(i, candidate, score):
+					stopped = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// The highest scoring candidate, the first in the space's order if several tie.
+// Returns false if every candidate was skipped.
+func sweepBest(space Space, workers int, objective Objective) (SweepResult, bool, error) {
+	var best SweepResult
+	bestIndex := -1
+	err := sweep(space, workers, objective, func(i int, candidate []int, score int) bool {
+		if bestIndex < 0 || score > best.score || (score == best.score && i < bestIndex) {
+			best, bestIndex = SweepResult{candidate, score}, i
+		}
+		return true
+	})
+	return best, bestIndex >= 0, err
+}
+
+// Every matching candidate, in the space's order
+func sweepMatches(space Space, workers int, predicate Predicate) ([][]int, error) {
+	found := make(map[int][]int)
+	err := sweep(space, workers, predicateScore(predicate), func(i int, candidate []int, score int) bool {
+		if score != 0 {
+			found[i] = candidate
+		}
+		return true
+	})
+	indexes := make([]int, 0, len(found))
+	for i := range found {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	matches := make([][]int, len(indexes))
+	for k, i := range indexes {
+		matches[k] = found[i]
+	}
+	return matches, err
+}
+
+// The first matching candidate in the space's order. Candidates after the first match found
+// aren't started, but those before it still run in case one of them matches.
+func sweepFirst(space Space, workers int, predicate Predicate) ([]int, bool, error) {
+	var first []int
+	firstIndex := -1
+	err := sweep(space, workers, predicateScore(predicate), func(i int, candidate []int, score int) bool {
+		if score != 0 && (firstIndex < 0 || i < firstIndex) {
+			first, firstIndex = candidate, i
+		}
+		return firstIndex < 0
+	})
+	return first, firstIndex >= 0, err
+}
+
+func predicateScore(predicate Predicate) Objective {
+	return func(candidate []int) (int, error) {
+		match, err := predicate(candidate)
+		if match {
+			return 1, err
+		}
+		return 0, err
+	}
+}
+
+// Matches candidates that objective gives value
+func scores(objective Objective, value int) Predicate {
+	return func(candidate []int) (bool, error) {
+		score, err := objective(candidate)
+		return err == nil && score == value, err
+	}
+}
+
+// Run program with the candidate's values written to addrs, scoring it by the value left at result.
+// Each run may execute maxSteps instructions.
+func patchedRun(program string, addrs []int, result, maxSteps int) Objective {
+	return func(candidate []int) (int, error) {
+		computer, err := initComputer(program, nil)
+		if err != nil {
+			return 0, err
+		}
+		for k, addr := range addrs {
+			if addr < 0 || addr >= computer_ram {
+				return 0, computerError(ErrAddressOutOfRange, computer, fmt.Sprintf("patch address %d", addr))
+			}
+			store(computer, addr, candidate[k])
+		}
+		if err := runContext(context.Background(), computer, Budget{maxSteps: maxSteps}); err != nil {
+			return 0, err
+		}
+		if !computer.terminated {
+			return 0, computerError(ErrNoInput, computer, "")
+		}
+		return peek(computer, result), nil
+	}
+}
+
+// Run program with the candidate queued as input, scoring it by its last output.
+// Each run may execute maxSteps instructions.
+func inputRun(program string, maxSteps int) Objective {
+	return func(candidate []int) (int, error) {
+		computer, err := initComputer(program, candidate)
+		if err != nil {
+			return 0, err
+		}
+		if err := runContext(context.Background(), computer, Budget{maxSteps: maxSteps}); err != nil {
+			return 0, err
+		}
+		if !computer.terminated {
+			return 0, computerError(ErrNoInput, computer, "")
+		}
+		if len(computer.outputs) == 0 {
+			return 0, computerError(ErrNoOutput, computer, "")
+		}
+		return computer.outputs[len(computer.outputs)-1], nil
+	}
+}
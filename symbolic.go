@@ -0,0 +1,627 @@
+// Symbolic execution of ship computer programs.
+//
+// A SymComputer runs a program in which chosen memory cells and inputs are symbols: unknowns,
+// each with a range of values it may take. ADD, MUL, LT and EQ on symbolic values build
+// expression trees instead of numbers, and a jump that depends on a symbol forks the run, each
+// path remembering which way the jump went. explore runs every path to its end; solveMemory
+// and solveOutput then search the paths for symbol values that give a wanted result.
+//
+// Symbols can't be used as addresses. Writing through a symbolic address, jumping to one or
+// moving the relative base by one fails with ErrSymbolicAddress. Reading through one gives an
+// opaque value, which is only an error if a jump or a solve depends on it; day 2's first
+// instruction reads through its noun and verb, but its result is overwritten unused.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrSymbolicAddress = errors.New("symbol used as an address")
+
+type exprKind int
+
+const (
+	exprConst exprKind = iota
+	exprSym
+	exprAdd
+	exprMul
+	exprLess
+	exprEqual
+	exprOpaque // read through a symbolic address
+)
+
+// A value in a symbolic run: a number, a symbol, or an operation on other Exprs
+type Expr struct {
+	kind  exprKind
+	value int    // exprConst
+	sym   int    // exprSym: index into the computer's symbols
+	name  string // exprSym
+	a, b  *Expr  // operands; for exprOpaque, a is the address read from
+}
+
+// An unknown, and the values it may take
+type Symbol struct {
+	name     string
+	min, max int
+}
+
+func constExpr(value int) *Expr {
+	return &Expr{kind: exprConst, value: value}
+}
+
+func (e *Expr) isConst(value int) bool {
+	return e.kind == exprConst && e.value == value
+}
+
+// Operations on Exprs. These fold constants, so arithmetic on numbers gives numbers.
+func addExpr(a, b *Expr) *Expr {
+	switch {
+	case a.kind == exprConst && b.kind == exprConst:
+		return constExpr(a.value + b.value)
+	case a.isConst(0):
+		return b
+	case b.isConst(0):
+		return a
+	}
+	return &Expr{kind: exprAdd, a: a, b: b}
+}
+
+func mulExpr(a, b *Expr) *Expr {
+	switch {
+	case a.kind == exprConst && b.kind == exprConst:
+		return constExpr(a.value * b.value)
+	case a.isConst(0) || b.isConst(0):
+		return constExpr(0)
+	case a.isConst(1):
+		return b
+	case b.isConst(1):
+		return a
+	}
+	return &Expr{kind: exprMul, a: a, b: b}
+}
+
+// kind is exprLess or exprEqual
+func compareExpr(kind exprKind, a, b *Expr) *Expr {
+	if a.kind == exprConst && b.kind == exprConst {
+		if (kind == exprLess && a.value < b.value) || (kind == exprEqual && a.value == b.value) {
+			return constExpr(1)
+		}
+		return constExpr(0)
+	}
+	return &Expr{kind: kind, a: a, b: b}
+}
+
+func (e *Expr) String() string {
+	switch e.kind {
+	case exprConst:
+		return strconv.Itoa(e.value)
+	case exprSym:
+		return e.name
+	case exprAdd:
+		return fmt.Sprintf("(%v + %v)", e.a, e.b)
+	case exprMul:
+		return fmt.Sprintf("%v*%v", e.a, e.b)
+	case exprLess:
+		return fmt.Sprintf("(%v < %v)", e.a, e.b)
+	case exprEqual:
+		return fmt.Sprintf("(%v == %v)", e.a, e.b)
+	}
+	return fmt.Sprintf("[%v]", e.a)
+}
+
+// The value of e with each symbol i set to values[i]. e must not hold an exprOpaque,
+// which callers check for with hasOpaque.
+func (e *Expr) eval(values []int) int {
+	switch e.kind {
+	case exprConst:
+		return e.value
+	case exprSym:
+		return values[e.sym]
+	case exprAdd:
+		return e.a.eval(values) + e.b.eval(values)
+	case exprMul:
+		return e.a.eval(values) * e.b.eval(values)
+	case exprLess:
+		if e.a.eval(values) < e.b.eval(values) {
+			return 1
+		}
+	case exprEqual:
+		if e.a.eval(values) == e.b.eval(values) {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (e *Expr) hasOpaque() bool {
+	switch e.kind {
+	case exprConst, exprSym:
+		return false
+	case exprOpaque:
+		return true
+	}
+	return e.a.hasOpaque() || e.b.hasOpaque()
+}
+
+// Index of the last symbol e uses, or -1 if it uses none. Also marks the symbols used.
+func (e *Expr) symbols(used []bool) int {
+	switch e.kind {
+	case exprConst, exprOpaque:
+		return -1
+	case exprSym:
+		used[e.sym] = true
+		return e.sym
+	}
+	a, b := e.a.symbols(used), e.b.symbols(used)
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// c + the sum of coeffs[i] times symbol i
+type affine struct {
+	coeffs []int
+	c      int
+}
+
+// Write e as an affine function of its n symbols, if it is one
+func (e *Expr) linear(n int) (affine, bool) {
+	switch e.kind {
+	case exprConst:
+		return affine{make([]int, n), e.value}, true
+	case exprSym:
+		f := affine{make([]int, n), 0}
+		f.coeffs[e.sym] = 1
+		return f, true
+	case exprAdd, exprMul:
+		a, ok := e.a.linear(n)
+		if !ok {
+			return a, false
+		}
+		b, ok := e.b.linear(n)
+		if !ok {
+			return b, false
+		}
+		if e.kind == exprAdd {
+			return a.plus(b, 1), true
+		}
+		if a.isConstant() {
+			return b.scale(a.c), true
+		}
+		if b.isConstant() {
+			return a.scale(b.c), true
+		}
+	}
+	return affine{}, false
+}
+
+func (f affine) isConstant() bool {
+	for _, k := range f.coeffs {
+		if k != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// f + k*g
+func (f affine) plus(g affine, k int) affine {
+	sum := affine{make([]int, len(f.coeffs)), f.c + k*g.c}
+	for i := range f.coeffs {
+		sum.coeffs[i] = f.coeffs[i] + k*g.coeffs[i]
+	}
+	return sum
+}
+
+func (f affine) scale(k int) affine {
+	scaled := affine{make([]int, len(f.coeffs)), k * f.c}
+	for i, coeff := range f.coeffs {
+		scaled.coeffs[i] = k * coeff
+	}
+	return scaled
+}
+
+// Index of the last symbol with a non-zero coefficient, or -1
+func (f affine) top() int {
+	for i := len(f.coeffs) - 1; i >= 0; i-- {
+		if f.coeffs[i] != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// One way through a program
+type SymPath struct {
+	state            []int         // concrete memory
+	symbolic         map[int]*Expr // cells holding anything but a number, overriding state
+	ip, relativeBase int
+	inputs, outputs  []*Expr
+	conditions       []pathCondition // what the symbols must satisfy for the run to come this way
+	steps            int
+	terminated       bool // halted, rather than stopped for lack of input
+}
+
+// A jump condition that was non-zero, or zero, on a path
+type pathCondition struct {
+	expr    *Expr
+	nonzero bool
+}
+
+type SymComputer struct {
+	symbols []Symbol
+	start   *SymPath
+}
+
+func initSymComputer(program string) (*SymComputer, error) {
+	computer, err := initComputer(program, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SymComputer{start: &SymPath{state: computer.state, symbolic: make(map[int]*Expr)}}, nil
+}
+
+func newSymbol(computer *SymComputer, name string, min, max int) *Expr {
+	computer.symbols = append(computer.symbols, Symbol{name, min, max})
+	return &Expr{kind: exprSym, sym: len(computer.symbols) - 1, name: name}
+}
+
+// Replace the value at addr with a symbol taking values from min to max
+func symbolizeCell(computer *SymComputer, addr int, name string, min, max int) error {
+	if addr < 0 || addr >= computer_ram {
+		return fmt.Errorf("address %d is out of range", addr)
+	}
+	symStore(computer.start, addr, newSymbol(computer, name, min, max))
+	return nil
+}
+
+// Queue a symbol taking values from min to max as the next input
+func addSymbolicInput(computer *SymComputer, name string, min, max int) {
+	computer.start.inputs = append(computer.start.inputs, newSymbol(computer, name, min, max))
+}
+
+// Queue known input values
+func addConcreteInput(computer *SymComputer, values ...int) {
+	for _, value := range values {
+		computer.start.inputs = append(computer.start.inputs, constExpr(value))
+	}
+}
+
+// Like computerError, for a path
+func symError(kind error, path *SymPath, detail string) error {
+	e := &ComputerError{Err: kind, IP: path.ip, RelativeBase: path.relativeBase, Detail: detail}
+	if op := symCell(path, path.ip); op.kind == exprConst {
+		e.Opcode = op.value
+	}
+	return e
+}
+
+func (path *SymPath) clone() *SymPath {
+	copied := *path
+	copied.state = append([]int(nil), path.state...)
+	copied.symbolic = make(map[int]*Expr, len(path.symbolic))
+	for addr, e := range path.symbolic {
+		copied.symbolic[addr] = e
+	}
+	copied.inputs = append([]*Expr(nil), path.inputs...)
+	copied.outputs = append([]*Expr(nil), path.outputs...)
+	copied.conditions = append([]pathCondition(nil), path.conditions...)
+	return &copied
+}
+
+// Read memory; cells never written read as 0
+func symCell(path *SymPath, addr int) *Expr {
+	if e, ok := path.symbolic[addr]; ok {
+		return e
+	}
+	if addr < 0 || addr >= len(path.state) {
+		return constExpr(0)
+	}
+	return constExpr(path.state[addr])
+}
+
+// Like store, keeping symbolic values apart from the concrete memory
+func symStore(path *SymPath, addr int, e *Expr) {
+	if addr >= len(path.state) {
+		grown := make([]int, grownSize(len(path.state), addr))
+		copy(grown, path.state)
+		path.state = grown
+	}
+	if e.kind == exprConst {
+		path.state[addr] = e.value
+		delete(path.symbolic, addr)
+	} else {
+		path.state[addr] = 0
+		path.symbolic[addr] = e
+	}
+}
+
+// The number e holds, failing if it is symbolic. use says what the number is for.
+func concreteValue(path *SymPath, e *Expr, use string) (int, error) {
+	if e.kind != exprConst {
+		return 0, symError(ErrSymbolicAddress, path, fmt.Sprintf("%s is %v", use, e))
+	}
+	return e.value, nil
+}
+
+// The expression a parameter stands for. Reading through a symbolic address gives an opaque value.
+func symParamValue(path *SymPath, mode ParamMode, loc int) (*Expr, error) {
+	param := symCell(path, loc)
+	switch mode {
+	case DIRECT:
+		return param, nil
+	case POS, RELATIVE:
+		if param.kind != exprConst {
+			return &Expr{kind: exprOpaque, a: param}, nil
+		}
+		addr, err := symParamAddr(path, mode, loc)
+		if err != nil {
+			return nil, err
+		}
+		return symCell(path, addr), nil
+	}
+	return nil, symError(ErrBadParamMode, path, fmt.Sprintf("mode %d for parameter at %d", mode, loc))
+}
+
+// Like getParamAddr, failing if the parameter is symbolic
+func symParamAddr(path *SymPath, mode ParamMode, loc int) (int, error) {
+	param, err := concreteValue(path, symCell(path, loc), fmt.Sprintf("address at %d", loc))
+	if err != nil {
+		return 0, err
+	}
+	return paramAddr(mode, loc, param, path.relativeBase, func(kind error, detail string) error {
+		return symError(kind, path, detail)
+	})
+}
+
+// Execute the next instruction on a path. A jump that depends on a symbol takes the jump on
+// this path, and returns a new path that doesn't. A path that has halted or is waiting for
+// input is left unchanged.
+func stepSym(path *SymPath) (fork *SymPath, err error) {
+	if path.ip < 0 || path.ip >= computer_ram {
+		return nil, symError(ErrAddressOutOfRange, path, fmt.Sprintf("instruction pointer %d", path.ip))
+	}
+	op, err := concreteValue(path, symCell(path, path.ip), "instruction")
+	if err != nil {
+		return nil, err
+	}
+	opcode, modes := decodeOp(op)
+	info, ok := instructionSet[opcode]
+	switch {
+	case !ok:
+		return nil, symError(ErrUnknownOpcode, path, "")
+	case opcode == 99:
+		path.terminated = true
+		return nil, nil
+	case opcode == 3 && len(path.inputs) == 0:
+		return nil, nil
+	}
+
+	// Values of the read parameters, and the address of the written one
+	values := make([]*Expr, info.params+1)
+	var dest int
+	for p := 1; p <= info.params; p++ {
+		if p == info.write {
+			dest, err = symParamAddr(path, modes[p], path.ip+p)
+		} else {
+			values[p], err = symParamValue(path, modes[p], path.ip+p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	next := path.ip + info.params + 1
+	switch opcode {
+	case 1:
+		symStore(path, dest, addExpr(values[1], values[2]))
+	case 2:
+		symStore(path, dest, mulExpr(values[1], values[2]))
+	case 3:
+		symStore(path, dest, path.inputs[0])
+		path.inputs = path.inputs[1:]
+	case 4:
+		path.outputs = append(path.outputs, values[1])
+	case 5, 6:
+		cond := values[1]
+		if cond.kind == exprConst && (cond.value != 0) != (opcode == 5) {
+			break
+		}
+		if cond.hasOpaque() {
+			return nil, symError(ErrSymbolicAddress, path, fmt.Sprintf("jump condition %v reads through a symbolic address", cond))
+		}
+		target, err := concreteValue(path, values[2], "jump target")
+		if err != nil {
+			return nil, err
+		}
+		if cond.kind != exprConst {
+			fork = path.clone()
+			fork.ip = next
+			fork.steps++
+			fork.conditions = append(fork.conditions, pathCondition{cond, opcode == 6})
+			path.conditions = append(path.conditions, pathCondition{cond, opcode == 5})
+		}
+		next = target
+	case 7:
+		symStore(path, dest, compareExpr(exprLess, values[1], values[2]))
+	case 8:
+		symStore(path, dest, compareExpr(exprEqual, values[1], values[2]))
+	case 9:
+		offset, err := concreteValue(path, values[1], "relative base adjustment")
+		if err != nil {
+			return nil, err
+		}
+		path.relativeBase += offset
+	}
+	path.ip = next
+	path.steps++
+	return fork, nil
+}
+
+// Run every path through the program until each halts or needs input. Paths come back in a
+// fixed order: at each fork, the paths that took the jump come before those that didn't.
+// A path running more than maxSteps instructions, or a fork past maxPaths paths, fails with
+// ErrBudgetExceeded.
+func explore(computer *SymComputer, maxSteps, maxPaths int) ([]*SymPath, error) {
+	var paths []*SymPath
+	pending := []*SymPath{computer.start.clone()}
+	for started := 1; len(pending) > 0; {
+		path := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for !path.terminated {
+			if path.steps >= maxSteps {
+				return nil, symError(ErrBudgetExceeded, path, fmt.Sprintf("step limit of %d reached", maxSteps))
+			}
+			steps := path.steps
+			fork, err := stepSym(path)
+			if err != nil {
+				return nil, err
+			}
+			if fork != nil {
+				if started++; started > maxPaths {
+					return nil, symError(ErrBudgetExceeded, path, fmt.Sprintf("more than %d paths", maxPaths))
+				}
+				pending = append(pending, fork)
+			}
+			if path.steps == steps {
+				break // waiting for input
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Find symbol values for which a path halts with value at addr
+func solveMemory(computer *SymComputer, paths []*SymPath, addr, value int) (map[string]int, bool, error) {
+	return solveFor(computer, paths, value, func(path *SymPath) *Expr {
+		if !path.terminated {
+			return nil
+		}
+		return symCell(path, addr)
+	})
+}
+
+// Find symbol values for which a path's output n (counting from 0) is value
+func solveOutput(computer *SymComputer, paths []*SymPath, n, value int) (map[string]int, bool, error) {
+	return solveFor(computer, paths, value, func(path *SymPath) *Expr {
+		if n >= len(path.outputs) {
+			return nil
+		}
+		return path.outputs[n]
+	})
+}
+
+// Find symbol values for which goal gives value on some path, along with its conditions.
+// Paths are tried in order, and each symbol's values from its min up, so the answer is the
+// first in that order. goal returns nil for paths that can't reach it.
+func solveFor(computer *SymComputer, paths []*SymPath, value int, goal func(path *SymPath) *Expr) (map[string]int, bool, error) {
+	for _, path := range paths {
+		result := goal(path)
+		if result == nil {
+			continue
+		}
+		if result.hasOpaque() {
+			return nil, false, symError(ErrSymbolicAddress, path, fmt.Sprintf("result %v reads through a symbolic address", result))
+		}
+		conditions := append(path.conditions[:len(path.conditions):len(path.conditions)],
+			pathCondition{compareExpr(exprEqual, result, constExpr(value)), true})
+		if values, ok := solveConditions(computer.symbols, conditions); ok {
+			solution := make(map[string]int)
+			for i, symbol := range computer.symbols {
+				solution[symbol.name] = values[i]
+			}
+			return solution, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// Backtracking search for symbol values meeting every condition. Symbols are set in order;
+// a condition is checked as soon as the last symbol it uses is set, and a symbol that is the
+// last unknown in an affine equation is solved for instead of searched.
+type symSolver struct {
+	symbols   []Symbol
+	values    []int
+	used      []bool
+	checks    [][]pathCondition // by 1 + the last symbol they use
+	equations [][]affine        // equations equal to zero, by the last symbol they use
+}
+
+func solveConditions(symbols []Symbol, conditions []pathCondition) ([]int, bool) {
+	n := len(symbols)
+	s := &symSolver{
+		symbols:   symbols,
+		values:    make([]int, n),
+		used:      make([]bool, n),
+		checks:    make([][]pathCondition, n+1),
+		equations: make([][]affine, n),
+	}
+	for _, cond := range conditions {
+		last := cond.expr.symbols(s.used)
+		s.checks[last+1] = append(s.checks[last+1], cond)
+		if !cond.nonzero || cond.expr.kind != exprEqual {
+			continue
+		}
+		a, ok := cond.expr.a.linear(n)
+		if !ok {
+			continue
+		}
+		b, ok := cond.expr.b.linear(n)
+		if eq := a.plus(b, -1); ok && eq.top() >= 0 {
+			s.equations[eq.top()] = append(s.equations[eq.top()], eq)
+		}
+	}
+	if !s.holds(s.checks[0]) || !s.search(0) {
+		return nil, false
+	}
+	return s.values, true
+}
+
+func (s *symSolver) search(i int) bool {
+	if i == len(s.symbols) {
+		return true
+	}
+	symbol := s.symbols[i]
+	if !s.used[i] {
+		s.values[i] = symbol.min
+		return s.search(i + 1)
+	}
+	if len(s.equations[i]) > 0 {
+		eq := s.equations[i][0]
+		rest := eq.c
+		for j := 0; j < i; j++ {
+			rest += eq.coeffs[j] * s.values[j]
+		}
+		if rest%eq.coeffs[i] != 0 {
+			return false
+		}
+		value := -rest / eq.coeffs[i]
+		return value >= symbol.min && value <= symbol.max && s.try(i, value)
+	}
+	for value := symbol.min; value <= symbol.max; value++ {
+		if s.try(i, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set symbol i to value, and search on if the conditions checked so far hold
+func (s *symSolver) try(i, value int) bool {
+	s.values[i] = value
+	return s.holds(s.checks[i+1]) && s.search(i+1)
+}
+
+func (s *symSolver) holds(conditions []pathCondition) bool {
+	for _, cond := range conditions {
+		if (cond.expr.eval(s.values) != 0) != cond.nonzero {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+// Execution tracing for the ship computer.
+//
+// Attach a JSONTracer with attachTracer to get one JSON object per executed instruction, e.g.
+//
+//	{"step":1,"ip":0,"opcode":3,"mnemonic":"IN","modes":[0],"operands":[9],"writes":[{"addr":9,"old":-1,"new":8}],"input":8}
+//
+// Traces are deterministic, so two runs can be compared with diff.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Writes each TraceRecord as a line of JSON. The first write error stops the trace and is kept in err.
+type JSONTracer struct {
+	enc *json.Encoder
+	err error
+}
+
+func newJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) Trace(record TraceRecord) {
+	if t.err == nil {
+		t.err = t.enc.Encode(record)
+	}
+}
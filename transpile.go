@@ -0,0 +1,321 @@
+// Compiling ship computer programs to Go.
+//
+// transpile turns a program into a Go function
+//
+//	func name(in InputSource, out OutputSink) (*IntComputer, error)
+//
+// that behaves like loading the program with initComputer, attaching in and out, and calling
+// run. Each instruction becomes a labelled block and jumps become gotos; jumps to computed
+// addresses go through a dispatch switch. The returned computer holds the final state.
+//
+// The compiled code covers instructions reachable from address 0 by static control flow, plus
+// any immediate operand of an add or multiply that decodes as an instruction, since that's how
+// programs store return addresses. Whenever the compiled code can't safely continue it hands the machine over to the
+// interpreter: on a write into a compiled instruction, a jump to an address that wasn't
+// compiled, or anything that would be an error, so errors are reported exactly as run does.
+
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Find the instructions to compile
+func transpiledInstructions(program []int) map[int]DisasmLine {
+	lines := make(map[int]DisasmLine)
+	work := []int{0}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		if _, seen := lines[addr]; seen || addr < 0 || addr >= len(program) {
+			continue
+		}
+		line, ok := decodeInstruction(program, addr)
+		if !ok {
+			continue
+		}
+		lines[addr] = line
+
+		succs, _ := successors(program, addr, line, nil)
+		for _, succ := range succs {
+			work = append(work, succ.to)
+		}
+		if opcode := program[addr] % 100; opcode == 1 || opcode == 2 {
+			for p, mode := range line.modes[:2] {
+				if mode == DIRECT {
+					work = append(work, program[addr+p+1])
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// Generates the body of one transpiled function
+type goGen struct {
+	b       strings.Builder
+	program []int
+	lines   map[int]DisasmLine
+	code    map[int]bool // words of compiled instructions
+	block   *goBlock     // the instruction being generated
+}
+
+// The code for one instruction
+type goBlock struct {
+	src   string
+	uses  map[string]bool // helpers it needs
+	gotos map[int]bool    // instructions it jumps to with goto
+	ended bool            // always leaves compiled code
+	falls bool            // continues with the instruction after it
+}
+
+func (g *goGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.b, format, args...)
+}
+
+// Code to hand over to the interpreter at addr
+func (g *goGen) fallback(addr int) string {
+	g.block.uses["interpret"] = true
+	return fmt.Sprintf("return interpret(%d)", addr)
+}
+
+// Emit code putting the value of a parameter in variable name
+func (g *goGen) value(name string, mode ParamMode, param, addr int) {
+	switch {
+	case mode == DIRECT:
+		g.printf("\t\t%s := %d\n", name, param)
+	case mode == POS && param >= 0 && param < len(g.program):
+		g.printf("\t\t%s := c.state[%d]\n", name, param)
+	default:
+		expr := strconv.Itoa(param)
+		if mode == RELATIVE {
+			expr = fmt.Sprintf("c.relativeBase + %d", param)
+		}
+		g.block.uses["read"] = true
+		g.printf("\t\t%s, ok := read(%s)\n", name, expr)
+		g.printf("\t\tif !ok {\n\t\t%s\n\t\t}\n", g.fallback(addr))
+	}
+}
+
+// Emit code writing value through a parameter, counting the instruction as executed
+func (g *goGen) write(value string, mode ParamMode, param, addr, next int) {
+	if mode == POS && param >= 0 && param < len(g.program) {
+		g.printf("\t\tc.steps++\n")
+		g.printf("\t\tc.state[%d] = %s\n", param, value)
+		if g.code[param] {
+			g.printf("\t\t%s\n", g.fallback(next))
+			g.block.ended = true
+		}
+		return
+	}
+	expr := strconv.Itoa(param)
+	if mode == RELATIVE {
+		expr = fmt.Sprintf("c.relativeBase + %d", param)
+	}
+	g.printf("\t\tdest := %s\n", expr)
+	g.printf("\t\tif dest < 0 || dest >= computer_ram {\n\t\t%s\n\t\t}\n", g.fallback(addr))
+	g.printf("\t\tc.steps++\n")
+	g.printf("\t\tstore(c, dest, %s)\n", value)
+	g.block.uses["isCode"] = true
+	g.printf("\t\tif isCode(dest) {\n\t\t%s\n\t\t}\n", g.fallback(next))
+}
+
+// Emit a transfer of control to a known address
+func (g *goGen) jump(target int) {
+	if _, ok := g.lines[target]; ok {
+		g.block.gotos[target] = true
+		g.printf("\t\tgoto L%d\n", target)
+	} else {
+		g.printf("\t\t%s\n", g.fallback(target))
+	}
+}
+
+func (g *goGen) instruction(addr int, line DisasmLine, fallsInto bool) {
+	opcode := g.program[addr] % 100
+	next := addr + len(line.words)
+	params := line.words[1:]
+	modes := line.modes
+
+	g.block = &goBlock{uses: make(map[string]bool), gotos: make(map[int]bool)}
+	g.printf("// %s\n{\n", line)
+	switch opcode {
+	case 1, 2, 7, 8:
+		g.value("p1", modes[0], params[0], addr)
+		g.value("p2", modes[1], params[1], addr)
+		result := map[int]string{1: "p1 + p2", 2: "p1 * p2", 7: "boolInt(p1 < p2)", 8: "boolInt(p1 == p2)"}[opcode]
+		if opcode >= 7 {
+			g.block.uses["boolInt"] = true
+		}
+		g.write(result, modes[2], params[2], addr, next)
+	case 3:
+		g.printf("\t\tc.ip = %d\n", addr)
+		g.printf("\t\tpullInput(c)\n")
+		g.printf("\t\tif len(c.inputs) == 0 {\n\t\t\treturn c, nil\n\t\t}\n")
+		g.printf("\t\tinput := c.inputs[0]\n")
+		g.printf("\t\tc.inputs = c.inputs[1:]\n")
+		g.write("input", modes[0], params[0], addr, next)
+	case 4:
+		g.value("p1", modes[0], params[0], addr)
+		g.printf("\t\tc.steps++\n")
+		g.printf("\t\toutput(p1)\n")
+		g.block.uses["output"] = true
+	case 5, 6:
+		g.value("p1", modes[0], params[0], addr)
+		cond := "p1 != 0"
+		if opcode == 6 {
+			cond = "p1 == 0"
+		}
+		if modes[1] == DIRECT {
+			g.printf("\t\tc.steps++\n")
+			g.printf("\t\tif %s {\n", cond)
+			g.jump(params[1])
+			g.printf("\t\t}\n")
+		} else {
+			g.value("p2", modes[1], params[1], addr)
+			g.printf("\t\tc.steps++\n")
+			g.printf("\t\tif %s {\n\t\t\ttarget = p2\n\t\t\tgoto dispatch\n\t\t}\n", cond)
+			g.block.uses["dispatch"] = true
+		}
+	case 9:
+		g.value("p1", modes[0], params[0], addr)
+		g.printf("\t\tc.steps++\n")
+		g.printf("\t\tc.relativeBase += p1\n")
+	case 99:
+		g.printf("\t\tc.ip = %d\n", addr)
+		g.printf("\t\tc.terminated = true\n")
+		g.printf("\t\treturn c, nil\n")
+	}
+	if opcode != 99 && !g.block.ended {
+		if fallsInto {
+			g.block.falls = true
+		} else {
+			g.jump(next)
+		}
+	}
+	g.printf("\t}\n")
+	g.block.src = g.b.String()
+	g.b.Reset()
+}
+
+// Compile program into the Go source of a function called name (without a package clause)
+func transpile(program []int, name string) (string, error) {
+	if len(program) == 0 {
+		return "", fmt.Errorf("empty program")
+	}
+	g := &goGen{program: program, lines: transpiledInstructions(program), code: make(map[int]bool)}
+	if _, ok := g.lines[0]; !ok {
+		return "", fmt.Errorf("no valid instruction at address 0")
+	}
+	addrs := make([]int, 0, len(g.lines))
+	for addr, line := range g.lines {
+		addrs = append(addrs, addr)
+		for i := range line.words {
+			g.code[addr+i] = true
+		}
+	}
+	sort.Ints(addrs)
+
+	// Generate the instructions first, then keep the ones control can reach
+	blocks := make(map[int]*goBlock)
+	for i, addr := range addrs {
+		line := g.lines[addr]
+		fallsInto := i+1 < len(addrs) && addrs[i+1] == addr+len(line.words)
+		g.instruction(addr, line, fallsInto)
+		blocks[addr] = g.block
+	}
+	reached := map[int]bool{0: true}
+	for work := []int{0}; len(work) > 0; {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		block := blocks[addr]
+		next := []int{}
+		if block.falls {
+			next = append(next, addr+len(g.lines[addr].words))
+		}
+		if block.uses["dispatch"] {
+			next = append(next, addrs...)
+		}
+		for target := range block.gotos {
+			next = append(next, target)
+		}
+		for _, target := range next {
+			if !reached[target] {
+				reached[target] = true
+				work = append(work, target)
+			}
+		}
+	}
+	uses := make(map[string]bool)
+	labels := make(map[int]bool)
+	for addr := range reached {
+		for helper := range blocks[addr].uses {
+			uses[helper] = true
+		}
+		for target := range blocks[addr].gotos {
+			labels[target] = true
+		}
+	}
+	if uses["dispatch"] {
+		for _, addr := range addrs {
+			labels[addr] = true
+		}
+	}
+
+	g.printf("// %s runs a %d-word program compiled by transpile.\n", name, len(program))
+	g.printf("func %s(in InputSource, out OutputSink) (*IntComputer, error) {\n", name)
+	words := make([]string, len(program))
+	for i, word := range program {
+		words[i] = strconv.Itoa(word)
+	}
+	g.printf("c := &IntComputer{state: []int{%s}, highWater: %d}\n", strings.Join(words, ", "), len(program)-1)
+	g.printf("attachInput(c, in)\nattachOutput(c, out)\n")
+	if uses["interpret"] || uses["dispatch"] {
+		g.printf("interpret := func(ip int) (*IntComputer, error) {\nc.ip = ip\nreturn c, run(c)\n}\n")
+	}
+	if uses["read"] {
+		g.printf("read := func(addr int) (int, bool) {\nif addr < 0 || addr >= computer_ram {\nreturn 0, false\n}\nreturn peek(c, addr), true\n}\n")
+	}
+	if uses["output"] {
+		g.printf("output := func(value int) {\nif out != nil {\nout.Write(value)\n} else {\nc.outputs = append(c.outputs, value)\n}\n}\n")
+	}
+	if uses["isCode"] {
+		var codeAddrs []string
+		for addr := 0; addr < len(program); addr++ {
+			if g.code[addr] {
+				codeAddrs = append(codeAddrs, strconv.Itoa(addr))
+			}
+		}
+		g.printf("isCode := func(addr int) bool {\nswitch addr {\ncase %s:\nreturn true\n}\nreturn false\n}\n", strings.Join(codeAddrs, ", "))
+	}
+	if uses["boolInt"] {
+		g.printf("boolInt := func(b bool) int {\nif b {\nreturn 1\n}\nreturn 0\n}\n")
+	}
+	if uses["dispatch"] {
+		g.printf("var target int\ngoto L0\n\n")
+		g.printf("// Jumps to computed addresses\ndispatch:\nswitch target {\n")
+		for _, addr := range addrs {
+			g.printf("case %d:\ngoto L%d\n", addr, addr)
+		}
+		g.printf("}\nreturn interpret(target)\n\n")
+	}
+	for _, addr := range addrs {
+		if !reached[addr] {
+			continue
+		}
+		if labels[addr] {
+			g.printf("L%d:\n", addr)
+		}
+		g.b.WriteString(blocks[addr].src)
+	}
+	g.printf("}\n")
+
+	src, err := format.Source([]byte(g.b.String()))
+	if err != nil {
+		return "", fmt.Errorf("generated code doesn't parse: %v", err)
+	}
+	return string(src), nil
+}
@@ -0,0 +1,209 @@
+// Check compiled programs against the day 5, 7 and 9 examples, and against the interpreter.
+//
+// Usage:
+//
+//	go run computer.go disasm.go cfg.go transpile.go intcode2go.go -func example -o transpiled_examples.go data/transpile_examples
+//	go run computer.go computerio.go transpiled_examples.go transpilecheck.go
+
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+)
+
+// A compiled example, failing if the program isn't in data/transpile_examples
+func compiled(program string) func(InputSource, OutputSink) (*IntComputer, error) {
+	f, ok := exampleTable[program]
+	if !ok {
+		log.Fatalf("%s has not been compiled; regenerate transpiled_examples.go", program)
+	}
+	return f
+}
+
+// Run a program both ways and check the machines end up the same
+func runBoth(program string, inputs ...int) *IntComputer {
+	vm, err := initComputer(program, inputs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := run(vm); err != nil {
+		log.Fatal(err)
+	}
+	c, err := compiled(program)(newSliceInput(inputs...), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, vmState := snapshotComputer(vm)
+	_, state := snapshotComputer(c)
+	switch {
+	case !sliceEqual(vm.outputs, c.outputs):
+		log.Fatalf("%s with inputs %v: interpreter output %v, compiled output %v", program, inputs, vm.outputs, c.outputs)
+	case vmState != state:
+		log.Fatalf("%s with inputs %v: interpreter ends with %s, compiled with %s", program, inputs, vmState, state)
+	case vm.steps != c.steps || vm.terminated != c.terminated:
+		log.Fatalf("%s with inputs %v: interpreter ran %d instructions, compiled %d", program, inputs, vm.steps, c.steps)
+	}
+	return c
+}
+
+func sliceEqual(s1, s2 []int) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// All orderings of values
+func permutations(values []int) [][]int {
+	if len(values) <= 1 {
+		return [][]int{append([]int(nil), values...)}
+	}
+	var perms [][]int
+	for i := range values {
+		rest := append(append([]int(nil), values[:i]...), values[i+1:]...)
+		for _, perm := range permutations(rest) {
+			perms = append(perms, append([]int{values[i]}, perm...))
+		}
+	}
+	return perms
+}
+
+func settingString(settings []int) string {
+	s := ""
+	for _, setting := range settings {
+		s += strconv.Itoa(setting)
+	}
+	return s
+}
+
+func day5Examples() {
+	tests := []struct {
+		program, state string
+		input, output  int
+	}{
+		{"1,0,0,0,99", "2,0,0,0,99", 0, 0},
+		{"2,3,0,3,99", "2,3,0,6,99", 0, 0},
+		{"2,4,4,5,99,0", "2,4,4,5,99,9801", 0, 0},
+		{"1,1,1,4,99,5,6,0,99", "30,1,1,4,2,5,6,0,99", 0, 0},
+		{"3,0,4,0,99", "42,0,4,0,99", 42, 42},
+		{"1002,4,3,4,33", "1002,4,3,4,99", 0, 0},
+		{"1101,100,-1,4,0", "1101,100,-1,4,99", 0, 0},
+		{"3,9,8,9,10,9,4,9,99,-1,8", "", 42, 0},
+		{"3,9,8,9,10,9,4,9,99,-1,8", "", 8, 1},
+		{"3,9,7,9,10,9,4,9,99,-1,8", "", 8, 0},
+		{"3,9,7,9,10,9,4,9,99,-1,8", "", 7, 1},
+		{"3,3,1108,-1,8,3,4,3,99", "", 0, 0},
+		{"3,3,1108,-1,8,3,4,3,99", "", 8, 1},
+		{"3,3,1107,-1,8,3,4,3,99", "", 7, 1},
+		{"3,3,1107,-1,8,3,4,3,99", "", 8, 0},
+		{"3,12,6,12,15,1,13,14,13,4,13,99,-1,0,1,9", "", 0, 0},
+		{"3,12,6,12,15,1,13,14,13,4,13,99,-1,0,1,9", "", 2, 1},
+		{"3,12,6,12,15,1,13,14,13,4,13,99,-1,0,1,9", "", -2, 1},
+		{"3,3,1105,-1,9,1101,0,0,12,4,12,99,1", "", 0, 0},
+		{"3,3,1105,-1,9,1101,0,0,12,4,12,99,1", "", 2, 1},
+		{"3,3,1105,-1,9,1101,0,0,12,4,12,99,1", "", -2, 1},
+		{"3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99", "", 7, 999},
+		{"3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99", "", 8, 1000},
+		{"3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99", "", 9, 1001}}
+	for id, test := range tests {
+		output, state := snapshotComputer(runBoth(test.program, test.input))
+		if output != test.output || (test.state != "" && state != test.state) {
+			log.Fatalf("Day 5 example #%d: expected %d and %s, got %d and %s", id, test.output, test.state, output, state)
+		}
+	}
+	log.Println("Day 5 examples passed.")
+}
+
+// Thrust from a chain of amplifiers running the compiled program once each
+func compiledThrust(program string, settings []int) int {
+	signal := 0
+	for _, setting := range settings {
+		c := runBoth(program, setting, signal)
+		signal = c.outputs[0]
+	}
+	return signal
+}
+
+// Thrust from a feedback loop of amplifiers running the compiled program on goroutines
+func compiledFeedbackThrust(program string, settings []int) int {
+	f := compiled(program)
+	links := make([]chan int, len(settings))
+	for i, setting := range settings {
+		links[i] = make(chan int, 2)
+		links[i] <- setting
+	}
+	links[0] <- 0
+
+	var wg sync.WaitGroup
+	for i := range settings {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := f(ChanInput(links[i]), ChanOutput(links[(i+1)%len(links)]))
+			if err != nil || !c.terminated {
+				log.Fatalf("amplifier %d didn't halt: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return <-links[0]
+}
+
+func day7Examples() {
+	tests := []struct {
+		program, settings string
+		output            int
+		feedback          bool
+	}{
+		{"3,15,3,16,1002,16,10,16,1,16,15,15,4,15,99,0,0", "43210", 43210, false},
+		{"3,23,3,24,1002,24,10,24,1002,23,-1,23,101,5,23,23,1,24,23,23,4,23,99,0,0", "01234", 54321, false},
+		{"3,31,3,32,1002,32,10,32,1001,31,-2,31,1007,31,0,33,1002,33,7,33,1,33,31,31,1,32,31,31,4,31,99,0,0,0", "10432", 65210, false},
+		{"3,26,1001,26,-4,26,3,27,1002,27,2,27,1,27,26,27,4,27,1001,28,-1,28,1005,28,6,99,0,0,5", "98765", 139629729, true},
+		{"3,52,1001,52,-5,52,3,53,1,52,56,54,1007,54,5,55,1005,55,26,1001,54,-5,54,1105,1,12,1,53,54,53,1008,54,0,55,1001,55,1,55,2,53,55,53,4,53,1001,56,-1,56,1005,56,6,99,0,0,0,0,10", "97856", 18216, true}}
+	for id, test := range tests {
+		phases, thrust := []int{0, 1, 2, 3, 4}, compiledThrust
+		if test.feedback {
+			phases, thrust = []int{5, 6, 7, 8, 9}, compiledFeedbackThrust
+		}
+		best, bestSettings := 0, ""
+		for _, settings := range permutations(phases) {
+			if t := thrust(test.program, settings); t > best {
+				best, bestSettings = t, settingString(settings)
+			}
+		}
+		if best != test.output || bestSettings != test.settings {
+			log.Fatalf("Day 7 example #%d: expected thrust %d with setting %s, got %d with setting %s", id, test.output, test.settings, best, bestSettings)
+		}
+	}
+	log.Println("Day 7 examples passed.")
+}
+
+func day9Examples() {
+	tests := []struct {
+		program string
+		output  []int
+	}{
+		{"109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99", []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}},
+		{"1102,34915192,34915192,7,4,7,99,0", []int{1219070632396864}},
+		{"104,1125899906842624,99", []int{1125899906842624}}}
+	for id, test := range tests {
+		if c := runBoth(test.program); !sliceEqual(c.outputs, test.output) {
+			log.Fatalf("Day 9 example #%d: expected %v, got %v", id, test.output, c.outputs)
+		}
+	}
+	log.Println("Day 9 examples passed.")
+}
+
+func main() {
+	day5Examples()
+	day7Examples()
+	day9Examples()
+}
@@ -0,0 +1,1205 @@
+// Code generated by intcode2go from data/transpile_examples. DO NOT EDIT.
+
+package main
+
+// example1 runs a 5-word program compiled by transpile.
+func example1(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{1, 0, 0, 0, 99}, highWater: 4}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: ADD [0], [0], [0]
+	{
+		p1 := c.state[0]
+		p2 := c.state[0]
+		c.steps++
+		c.state[0] = p1 + p2
+		return interpret(4)
+	}
+}
+
+// example2 runs a 5-word program compiled by transpile.
+func example2(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{2, 3, 0, 3, 99}, highWater: 4}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: MUL [3], [0], [3]
+	{
+		p1 := c.state[3]
+		p2 := c.state[0]
+		c.steps++
+		c.state[3] = p1 * p2
+		return interpret(4)
+	}
+}
+
+// example3 runs a 6-word program compiled by transpile.
+func example3(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{2, 4, 4, 5, 99, 0}, highWater: 5}
+	attachInput(c, in)
+	attachOutput(c, out)
+	// 0: MUL [4], [4], [5]
+	{
+		p1 := c.state[4]
+		p2 := c.state[4]
+		c.steps++
+		c.state[5] = p1 * p2
+	}
+	// 4: HALT
+	{
+		c.ip = 4
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example4 runs a 9-word program compiled by transpile.
+func example4(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{1, 1, 1, 4, 99, 5, 6, 0, 99}, highWater: 8}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: ADD [1], [1], [4]
+	{
+		p1 := c.state[1]
+		p2 := c.state[1]
+		c.steps++
+		c.state[4] = p1 + p2
+		return interpret(4)
+	}
+}
+
+// example5 runs a 5-word program compiled by transpile.
+func example5(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 0, 4, 0, 99}, highWater: 4}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: IN [0]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[0] = input
+		return interpret(2)
+	}
+}
+
+// example6 runs a 5-word program compiled by transpile.
+func example6(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{1002, 4, 3, 4, 33}, highWater: 4}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: MUL [4], #3, [4]
+	{
+		p1 := c.state[4]
+		p2 := 3
+		c.steps++
+		c.state[4] = p1 * p2
+		return interpret(4)
+	}
+}
+
+// example7 runs a 5-word program compiled by transpile.
+func example7(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{1101, 100, -1, 4, 0}, highWater: 4}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: ADD #100, #-1, [4]
+	{
+		p1 := 100
+		p2 := -1
+		c.steps++
+		c.state[4] = p1 + p2
+		return interpret(4)
+	}
+}
+
+// example8 runs a 11-word program compiled by transpile.
+func example8(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 9, 8, 9, 10, 9, 4, 9, 99, -1, 8}, highWater: 10}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// 0: IN [9]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[9] = input
+	}
+	// 2: EQ [9], [10], [9]
+	{
+		p1 := c.state[9]
+		p2 := c.state[10]
+		c.steps++
+		c.state[9] = boolInt(p1 == p2)
+	}
+	// 6: OUT [9]
+	{
+		p1 := c.state[9]
+		c.steps++
+		output(p1)
+	}
+	// 8: HALT
+	{
+		c.ip = 8
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example9 runs a 11-word program compiled by transpile.
+func example9(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 9, 7, 9, 10, 9, 4, 9, 99, -1, 8}, highWater: 10}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// 0: IN [9]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[9] = input
+	}
+	// 2: LT [9], [10], [9]
+	{
+		p1 := c.state[9]
+		p2 := c.state[10]
+		c.steps++
+		c.state[9] = boolInt(p1 < p2)
+	}
+	// 6: OUT [9]
+	{
+		p1 := c.state[9]
+		c.steps++
+		output(p1)
+	}
+	// 8: HALT
+	{
+		c.ip = 8
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example10 runs a 9-word program compiled by transpile.
+func example10(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 3, 1108, -1, 8, 3, 4, 3, 99}, highWater: 8}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: IN [3]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[3] = input
+		return interpret(2)
+	}
+}
+
+// example11 runs a 9-word program compiled by transpile.
+func example11(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 3, 1107, -1, 8, 3, 4, 3, 99}, highWater: 8}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: IN [3]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[3] = input
+		return interpret(2)
+	}
+}
+
+// example12 runs a 16-word program compiled by transpile.
+func example12(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9}, highWater: 15}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	var target int
+	goto L0
+
+	// Jumps to computed addresses
+dispatch:
+	switch target {
+	case 0:
+		goto L0
+	case 2:
+		goto L2
+	case 5:
+		goto L5
+	case 9:
+		goto L9
+	case 11:
+		goto L11
+	}
+	return interpret(target)
+
+L0:
+	// 0: IN [12]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[12] = input
+	}
+L2:
+	// 2: JF [12], [15]
+	{
+		p1 := c.state[12]
+		p2 := c.state[15]
+		c.steps++
+		if p1 == 0 {
+			target = p2
+			goto dispatch
+		}
+	}
+L5:
+	// 5: ADD [13], [14], [13]
+	{
+		p1 := c.state[13]
+		p2 := c.state[14]
+		c.steps++
+		c.state[13] = p1 + p2
+	}
+L9:
+	// 9: OUT [13]
+	{
+		p1 := c.state[13]
+		c.steps++
+		output(p1)
+	}
+L11:
+	// 11: HALT
+	{
+		c.ip = 11
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example13 runs a 13-word program compiled by transpile.
+func example13(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 3, 1105, -1, 9, 1101, 0, 0, 12, 4, 12, 99, 1}, highWater: 12}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	// 0: IN [3]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[3] = input
+		return interpret(2)
+	}
+}
+
+// example14 runs a 47-word program compiled by transpile.
+func example14(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 21, 1008, 21, 8, 20, 1005, 20, 22, 107, 8, 21, 20, 1006, 20, 31, 1106, 0, 36, 98, 0, 0, 1002, 21, 125, 20, 4, 20, 1105, 1, 46, 104, 999, 1105, 1, 46, 1101, 1000, 1, 20, 4, 20, 1105, 1, 46, 98, 99}, highWater: 46}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// 0: IN [21]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[21] = input
+	}
+	// 2: EQ [21], #8, [20]
+	{
+		p1 := c.state[21]
+		p2 := 8
+		c.steps++
+		c.state[20] = boolInt(p1 == p2)
+	}
+	// 6: JT [20], #22
+	{
+		p1 := c.state[20]
+		c.steps++
+		if p1 != 0 {
+			goto L22
+		}
+	}
+	// 9: LT #8, [21], [20]
+	{
+		p1 := 8
+		p2 := c.state[21]
+		c.steps++
+		c.state[20] = boolInt(p1 < p2)
+	}
+	// 13: JF [20], #31
+	{
+		p1 := c.state[20]
+		c.steps++
+		if p1 == 0 {
+			goto L31
+		}
+	}
+	// 16: JF #0, #36
+	{
+		p1 := 0
+		c.steps++
+		if p1 == 0 {
+			goto L36
+		}
+		return interpret(19)
+	}
+L22:
+	// 22: MUL [21], #125, [20]
+	{
+		p1 := c.state[21]
+		p2 := 125
+		c.steps++
+		c.state[20] = p1 * p2
+	}
+	// 26: OUT [20]
+	{
+		p1 := c.state[20]
+		c.steps++
+		output(p1)
+	}
+	// 28: JT #1, #46
+	{
+		p1 := 1
+		c.steps++
+		if p1 != 0 {
+			goto L46
+		}
+	}
+L31:
+	// 31: OUT #999
+	{
+		p1 := 999
+		c.steps++
+		output(p1)
+	}
+	// 33: JT #1, #46
+	{
+		p1 := 1
+		c.steps++
+		if p1 != 0 {
+			goto L46
+		}
+	}
+L36:
+	// 36: ADD #1000, #1, [20]
+	{
+		p1 := 1000
+		p2 := 1
+		c.steps++
+		c.state[20] = p1 + p2
+	}
+	// 40: OUT [20]
+	{
+		p1 := c.state[20]
+		c.steps++
+		output(p1)
+	}
+	// 42: JT #1, #46
+	{
+		p1 := 1
+		c.steps++
+		if p1 != 0 {
+			goto L46
+		}
+		return interpret(45)
+	}
+L46:
+	// 46: HALT
+	{
+		c.ip = 46
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example15 runs a 17-word program compiled by transpile.
+func example15(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 15, 3, 16, 1002, 16, 10, 16, 1, 16, 15, 15, 4, 15, 99, 0, 0}, highWater: 16}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	// 0: IN [15]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[15] = input
+	}
+	// 2: IN [16]
+	{
+		c.ip = 2
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[16] = input
+	}
+	// 4: MUL [16], #10, [16]
+	{
+		p1 := c.state[16]
+		p2 := 10
+		c.steps++
+		c.state[16] = p1 * p2
+	}
+	// 8: ADD [16], [15], [15]
+	{
+		p1 := c.state[16]
+		p2 := c.state[15]
+		c.steps++
+		c.state[15] = p1 + p2
+	}
+	// 12: OUT [15]
+	{
+		p1 := c.state[15]
+		c.steps++
+		output(p1)
+	}
+	// 14: HALT
+	{
+		c.ip = 14
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example16 runs a 25-word program compiled by transpile.
+func example16(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 23, 3, 24, 1002, 24, 10, 24, 1002, 23, -1, 23, 101, 5, 23, 23, 1, 24, 23, 23, 4, 23, 99, 0, 0}, highWater: 24}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	// 0: IN [23]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[23] = input
+	}
+	// 2: IN [24]
+	{
+		c.ip = 2
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[24] = input
+	}
+	// 4: MUL [24], #10, [24]
+	{
+		p1 := c.state[24]
+		p2 := 10
+		c.steps++
+		c.state[24] = p1 * p2
+	}
+	// 8: MUL [23], #-1, [23]
+	{
+		p1 := c.state[23]
+		p2 := -1
+		c.steps++
+		c.state[23] = p1 * p2
+	}
+	// 12: ADD #5, [23], [23]
+	{
+		p1 := 5
+		p2 := c.state[23]
+		c.steps++
+		c.state[23] = p1 + p2
+	}
+	// 16: ADD [24], [23], [23]
+	{
+		p1 := c.state[24]
+		p2 := c.state[23]
+		c.steps++
+		c.state[23] = p1 + p2
+	}
+	// 20: OUT [23]
+	{
+		p1 := c.state[23]
+		c.steps++
+		output(p1)
+	}
+	// 22: HALT
+	{
+		c.ip = 22
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example17 runs a 34-word program compiled by transpile.
+func example17(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 31, 3, 32, 1002, 32, 10, 32, 1001, 31, -2, 31, 1007, 31, 0, 33, 1002, 33, 7, 33, 1, 33, 31, 31, 1, 32, 31, 31, 4, 31, 99, 0, 0, 0}, highWater: 33}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// 0: IN [31]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[31] = input
+	}
+	// 2: IN [32]
+	{
+		c.ip = 2
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[32] = input
+	}
+	// 4: MUL [32], #10, [32]
+	{
+		p1 := c.state[32]
+		p2 := 10
+		c.steps++
+		c.state[32] = p1 * p2
+	}
+	// 8: ADD [31], #-2, [31]
+	{
+		p1 := c.state[31]
+		p2 := -2
+		c.steps++
+		c.state[31] = p1 + p2
+	}
+	// 12: LT [31], #0, [33]
+	{
+		p1 := c.state[31]
+		p2 := 0
+		c.steps++
+		c.state[33] = boolInt(p1 < p2)
+	}
+	// 16: MUL [33], #7, [33]
+	{
+		p1 := c.state[33]
+		p2 := 7
+		c.steps++
+		c.state[33] = p1 * p2
+	}
+	// 20: ADD [33], [31], [31]
+	{
+		p1 := c.state[33]
+		p2 := c.state[31]
+		c.steps++
+		c.state[31] = p1 + p2
+	}
+	// 24: ADD [32], [31], [31]
+	{
+		p1 := c.state[32]
+		p2 := c.state[31]
+		c.steps++
+		c.state[31] = p1 + p2
+	}
+	// 28: OUT [31]
+	{
+		p1 := c.state[31]
+		c.steps++
+		output(p1)
+	}
+	// 30: HALT
+	{
+		c.ip = 30
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example18 runs a 29-word program compiled by transpile.
+func example18(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 26, 1001, 26, -4, 26, 3, 27, 1002, 27, 2, 27, 1, 27, 26, 27, 4, 27, 1001, 28, -1, 28, 1005, 28, 6, 99, 0, 0, 5}, highWater: 28}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	// 0: IN [26]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[26] = input
+	}
+	// 2: ADD [26], #-4, [26]
+	{
+		p1 := c.state[26]
+		p2 := -4
+		c.steps++
+		c.state[26] = p1 + p2
+	}
+L6:
+	// 6: IN [27]
+	{
+		c.ip = 6
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[27] = input
+	}
+	// 8: MUL [27], #2, [27]
+	{
+		p1 := c.state[27]
+		p2 := 2
+		c.steps++
+		c.state[27] = p1 * p2
+	}
+	// 12: ADD [27], [26], [27]
+	{
+		p1 := c.state[27]
+		p2 := c.state[26]
+		c.steps++
+		c.state[27] = p1 + p2
+	}
+	// 16: OUT [27]
+	{
+		p1 := c.state[27]
+		c.steps++
+		output(p1)
+	}
+	// 18: ADD [28], #-1, [28]
+	{
+		p1 := c.state[28]
+		p2 := -1
+		c.steps++
+		c.state[28] = p1 + p2
+	}
+	// 22: JT [28], #6
+	{
+		p1 := c.state[28]
+		c.steps++
+		if p1 != 0 {
+			goto L6
+		}
+	}
+	// 25: HALT
+	{
+		c.ip = 25
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example19 runs a 57-word program compiled by transpile.
+func example19(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{3, 52, 1001, 52, -5, 52, 3, 53, 1, 52, 56, 54, 1007, 54, 5, 55, 1005, 55, 26, 1001, 54, -5, 54, 1105, 1, 12, 1, 53, 54, 53, 1008, 54, 0, 55, 1001, 55, 1, 55, 2, 53, 55, 53, 4, 53, 1001, 56, -1, 56, 1005, 56, 6, 99, 0, 0, 0, 0, 10}, highWater: 56}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	// 0: IN [52]
+	{
+		c.ip = 0
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[52] = input
+	}
+	// 2: ADD [52], #-5, [52]
+	{
+		p1 := c.state[52]
+		p2 := -5
+		c.steps++
+		c.state[52] = p1 + p2
+	}
+L6:
+	// 6: IN [53]
+	{
+		c.ip = 6
+		pullInput(c)
+		if len(c.inputs) == 0 {
+			return c, nil
+		}
+		input := c.inputs[0]
+		c.inputs = c.inputs[1:]
+		c.steps++
+		c.state[53] = input
+	}
+	// 8: ADD [52], [56], [54]
+	{
+		p1 := c.state[52]
+		p2 := c.state[56]
+		c.steps++
+		c.state[54] = p1 + p2
+	}
+L12:
+	// 12: LT [54], #5, [55]
+	{
+		p1 := c.state[54]
+		p2 := 5
+		c.steps++
+		c.state[55] = boolInt(p1 < p2)
+	}
+	// 16: JT [55], #26
+	{
+		p1 := c.state[55]
+		c.steps++
+		if p1 != 0 {
+			goto L26
+		}
+	}
+	// 19: ADD [54], #-5, [54]
+	{
+		p1 := c.state[54]
+		p2 := -5
+		c.steps++
+		c.state[54] = p1 + p2
+	}
+	// 23: JT #1, #12
+	{
+		p1 := 1
+		c.steps++
+		if p1 != 0 {
+			goto L12
+		}
+	}
+L26:
+	// 26: ADD [53], [54], [53]
+	{
+		p1 := c.state[53]
+		p2 := c.state[54]
+		c.steps++
+		c.state[53] = p1 + p2
+	}
+	// 30: EQ [54], #0, [55]
+	{
+		p1 := c.state[54]
+		p2 := 0
+		c.steps++
+		c.state[55] = boolInt(p1 == p2)
+	}
+	// 34: ADD [55], #1, [55]
+	{
+		p1 := c.state[55]
+		p2 := 1
+		c.steps++
+		c.state[55] = p1 + p2
+	}
+	// 38: MUL [53], [55], [53]
+	{
+		p1 := c.state[53]
+		p2 := c.state[55]
+		c.steps++
+		c.state[53] = p1 * p2
+	}
+	// 42: OUT [53]
+	{
+		p1 := c.state[53]
+		c.steps++
+		output(p1)
+	}
+	// 44: ADD [56], #-1, [56]
+	{
+		p1 := c.state[56]
+		p2 := -1
+		c.steps++
+		c.state[56] = p1 + p2
+	}
+	// 48: JT [56], #6
+	{
+		p1 := c.state[56]
+		c.steps++
+		if p1 != 0 {
+			goto L6
+		}
+	}
+	// 51: HALT
+	{
+		c.ip = 51
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example20 runs a 16-word program compiled by transpile.
+func example20(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}, highWater: 15}
+	attachInput(c, in)
+	attachOutput(c, out)
+	interpret := func(ip int) (*IntComputer, error) {
+		c.ip = ip
+		return c, run(c)
+	}
+	read := func(addr int) (int, bool) {
+		if addr < 0 || addr >= computer_ram {
+			return 0, false
+		}
+		return peek(c, addr), true
+	}
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	isCode := func(addr int) bool {
+		switch addr {
+		case 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15:
+			return true
+		}
+		return false
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+L0:
+	// 0: ARB #1
+	{
+		p1 := 1
+		c.steps++
+		c.relativeBase += p1
+		goto L2
+	}
+L2:
+	// 2: OUT rb-1
+	{
+		p1, ok := read(c.relativeBase + -1)
+		if !ok {
+			return interpret(2)
+		}
+		c.steps++
+		output(p1)
+	}
+	// 4: ADD [100], #1, [100]
+	{
+		p1, ok := read(100)
+		if !ok {
+			return interpret(4)
+		}
+		p2 := 1
+		dest := 100
+		if dest < 0 || dest >= computer_ram {
+			return interpret(4)
+		}
+		c.steps++
+		store(c, dest, p1+p2)
+		if isCode(dest) {
+			return interpret(8)
+		}
+	}
+	// 8: EQ [100], #16, [101]
+	{
+		p1, ok := read(100)
+		if !ok {
+			return interpret(8)
+		}
+		p2 := 16
+		dest := 101
+		if dest < 0 || dest >= computer_ram {
+			return interpret(8)
+		}
+		c.steps++
+		store(c, dest, boolInt(p1 == p2))
+		if isCode(dest) {
+			return interpret(12)
+		}
+	}
+	// 12: JF [101], #0
+	{
+		p1, ok := read(101)
+		if !ok {
+			return interpret(12)
+		}
+		c.steps++
+		if p1 == 0 {
+			goto L0
+		}
+	}
+	// 15: HALT
+	{
+		c.ip = 15
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example21 runs a 8-word program compiled by transpile.
+func example21(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{1102, 34915192, 34915192, 7, 4, 7, 99, 0}, highWater: 7}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	// 0: MUL #34915192, #34915192, [7]
+	{
+		p1 := 34915192
+		p2 := 34915192
+		c.steps++
+		c.state[7] = p1 * p2
+	}
+	// 4: OUT [7]
+	{
+		p1 := c.state[7]
+		c.steps++
+		output(p1)
+	}
+	// 6: HALT
+	{
+		c.ip = 6
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// example22 runs a 3-word program compiled by transpile.
+func example22(in InputSource, out OutputSink) (*IntComputer, error) {
+	c := &IntComputer{state: []int{104, 1125899906842624, 99}, highWater: 2}
+	attachInput(c, in)
+	attachOutput(c, out)
+	output := func(value int) {
+		if out != nil {
+			out.Write(value)
+		} else {
+			c.outputs = append(c.outputs, value)
+		}
+	}
+	// 0: OUT #1125899906842624
+	{
+		p1 := 1125899906842624
+		c.steps++
+		output(p1)
+	}
+	// 2: HALT
+	{
+		c.ip = 2
+		c.terminated = true
+		return c, nil
+	}
+}
+
+// The compiled programs by their source text
+var exampleTable = map[string]func(InputSource, OutputSink) (*IntComputer, error){
+	"1,0,0,0,99":                               example1,
+	"2,3,0,3,99":                               example2,
+	"2,4,4,5,99,0":                             example3,
+	"1,1,1,4,99,5,6,0,99":                      example4,
+	"3,0,4,0,99":                               example5,
+	"1002,4,3,4,33":                            example6,
+	"1101,100,-1,4,0":                          example7,
+	"3,9,8,9,10,9,4,9,99,-1,8":                 example8,
+	"3,9,7,9,10,9,4,9,99,-1,8":                 example9,
+	"3,3,1108,-1,8,3,4,3,99":                   example10,
+	"3,3,1107,-1,8,3,4,3,99":                   example11,
+	"3,12,6,12,15,1,13,14,13,4,13,99,-1,0,1,9": example12,
+	"3,3,1105,-1,9,1101,0,0,12,4,12,99,1":      example13,
+	"3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99": example14,
+	"3,15,3,16,1002,16,10,16,1,16,15,15,4,15,99,0,0":                                                                                                                                example15,
+	"3,23,3,24,1002,24,10,24,1002,23,-1,23,101,5,23,23,1,24,23,23,4,23,99,0,0":                                                                                                      example16,
+	"3,31,3,32,1002,32,10,32,1001,31,-2,31,1007,31,0,33,1002,33,7,33,1,33,31,31,1,32,31,31,4,31,99,0,0,0":                                                                           example17,
+	"3,26,1001,26,-4,26,3,27,1002,27,2,27,1,27,26,27,4,27,1001,28,-1,28,1005,28,6,99,0,0,5":                                                                                         example18,
+	"3,52,1001,52,-5,52,3,53,1,52,56,54,1007,54,5,55,1005,55,26,1001,54,-5,54,1105,1,12,1,53,54,53,1008,54,0,55,1001,55,1,55,2,53,55,53,4,53,1001,56,-1,56,1005,56,6,99,0,0,0,0,10": example19,
+	"109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99":                                                                                                                     example20,
+	"1102,34915192,34915192,7,4,7,99,0":                                                                                                                                             example21,
+	"104,1125899906842624,99":                                                                                                                                                       example22,
+}